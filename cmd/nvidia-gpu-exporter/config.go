@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/promslog"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/collector"
+)
+
+// configReloader applies --config.file on top of the command line. Settings
+// the file leaves out keep their command-line values, also when they are
+// removed from the file later.
+type configReloader struct {
+	path                           string
+	includeMetrics, excludeMetrics string
+	logLevel                       *promslog.Level
+	cmdlineLogLevel                string
+}
+
+func newConfigReloader(path, includeMetrics, excludeMetrics string, logLevel *promslog.Level) *configReloader {
+	return &configReloader{
+		path:            path,
+		includeMetrics:  includeMetrics,
+		excludeMetrics:  excludeMetrics,
+		logLevel:        logLevel,
+		cmdlineLogLevel: logLevel.String(),
+	}
+}
+
+// configSettings are the settings of a config file.
+type configSettings struct {
+	collectors                     *collector.Overrides
+	includeMetrics, excludeMetrics string
+	includeSet, excludeSet         bool
+	logLevel                       string
+	logLevelSet                    bool
+}
+
+// read parses the config file. Without one, nothing is overridden.
+func (r *configReloader) read() (*configSettings, error) {
+	s := &configSettings{}
+	if r.path == "" {
+		return s, nil
+	}
+	args, err := kingpin.ExpandArgsFromFile(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	app := kingpin.New("config.file", "").Terminate(nil).UsageWriter(io.Discard).ErrorWriter(io.Discard)
+	s.collectors = collector.OverrideFlags(app)
+	app.Flag("web.include-metrics", "").IsSetByUser(&s.includeSet).StringVar(&s.includeMetrics)
+	app.Flag("web.exclude-metrics", "").IsSetByUser(&s.excludeSet).StringVar(&s.excludeMetrics)
+	app.Flag("log.level", "").IsSetByUser(&s.logLevelSet).StringVar(&s.logLevel)
+	if _, err := app.Parse(args); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", r.path, err)
+	}
+	return s, nil
+}
+
+// settings returns the metric filter and log level in effect with s.
+func (r *configReloader) settings(s *configSettings) (metricFilter, string, error) {
+	include, exclude, level := r.includeMetrics, r.excludeMetrics, r.cmdlineLogLevel
+	if s.includeSet {
+		include = s.includeMetrics
+	}
+	if s.excludeSet {
+		exclude = s.excludeMetrics
+	}
+	if s.logLevelSet {
+		level = s.logLevel
+	}
+	filter, err := newMetricFilter(include, exclude)
+	if err != nil {
+		return filter, "", fmt.Errorf("metric filter: %w", err)
+	}
+	if err := promslog.NewLevel().Set(level); err != nil {
+		return filter, "", fmt.Errorf("log level: %w", err)
+	}
+	return filter, level, nil
+}
+
+// check validates the config file without applying it.
+func (r *configReloader) check() error {
+	s, err := r.read()
+	if err != nil {
+		return err
+	}
+	if _, _, err := r.settings(s); err != nil {
+		return err
+	}
+	return s.collectors.Check()
+}
+
+// reload reads the config file again and applies it to ngc, h and the log
+// level. Nothing is applied if the file is invalid.
+func (r *configReloader) reload(ngc *collector.NvidiaGPUCollector, h *metricsHandler) error {
+	s, err := r.read()
+	if err != nil {
+		return err
+	}
+	filter, level, err := r.settings(s)
+	if err != nil {
+		return err
+	}
+	if err := ngc.Reload(s.collectors); err != nil {
+		return err
+	}
+	h.filter.Store(&filter)
+	return r.logLevel.Set(level)
+}
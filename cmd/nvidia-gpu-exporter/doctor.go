@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/collector"
+)
+
+// runDoctor prints the environment checks to w and returns the exit code,
+// which is nonzero if any check failed.
+func runDoctor(w io.Writer, logger *slog.Logger) int {
+	defer collector.ShutdownDCGM()
+	defer collector.ShutdownNVML(logger)
+
+	code := 0
+	for _, check := range collector.Doctor(logger) {
+		status := " OK "
+		if !check.OK {
+			status = "FAIL"
+			code = 1
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", status, check.Name, check.Detail)
+	}
+	return code
+}
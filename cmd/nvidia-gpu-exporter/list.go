@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/collector"
+)
+
+// listCollectors prints the registered collectors, whether they are enabled
+// and the metrics they can export to w.
+func listCollectors(w io.Writer, logger *slog.Logger) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, c := range collector.ListCollectors(logger) {
+		state := "disabled"
+		if c.Enabled {
+			state = "enabled"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", c.Name, state)
+		if c.Err != nil {
+			fmt.Fprintf(tw, "  couldn't create collector: %s\n", c.Err)
+		}
+		for _, metric := range c.Metrics {
+			fmt.Fprintf(tw, "  %s\t%s\n", metric.Name, metric.Help)
+		}
+	}
+	return tw.Flush()
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/promslog/flag"
 
@@ -18,30 +24,244 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 
 	"github.com/V01d42/nvidia-gpu-exporter/internal/collector"
+	"github.com/V01d42/nvidia-gpu-exporter/internal/web"
 )
 
-func newHandler(maxRequests int, logger *slog.Logger) (http.Handler, error) {
-	ngc, err := collector.NewNvidiaGPUCollector(logger)
+// metricsHandler serves the metrics of a collector, bounding every
+// collection by the scrape timeout Prometheus sends along. Scrapes passing
+// collect[] parameters run only the named collectors of ngc, live even when
+// the collector serves snapshots.
+type metricsHandler struct {
+	collector collector.ContextCollector
+	ngc       *collector.NvidiaGPUCollector
+	// filter is replaced on reload.
+	filter        atomic.Pointer[metricFilter]
+	hostnameLabel bool
+	compat        []func(prometheus.Gatherer) prometheus.Gatherer
+	timeoutOffset time.Duration
+	inFlight      chan struct{}
+	logger        *slog.Logger
+}
+
+func newHandler(served collector.ContextCollector, ngc *collector.NvidiaGPUCollector, filter metricFilter, hostnameLabel bool, compat []func(prometheus.Gatherer) prometheus.Gatherer, maxRequests int, timeoutOffset time.Duration, logger *slog.Logger) *metricsHandler {
+	h := &metricsHandler{
+		collector:     served,
+		ngc:           ngc,
+		hostnameLabel: hostnameLabel,
+		compat:        compat,
+		timeoutOffset: timeoutOffset,
+		logger:        logger,
+	}
+	h.filter.Store(&filter)
+	if maxRequests > 0 {
+		h.inFlight = make(chan struct{}, maxRequests)
+	}
+	return h
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.inFlight != nil {
+		select {
+		case h.inFlight <- struct{}{}:
+			defer func() { <-h.inFlight }()
+		default:
+			http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", cap(h.inFlight)), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	served := h.collector
+	if filters := req.URL.Query()["collect[]"]; len(filters) > 0 {
+		h.logger.Debug("collect query", "filters", filters)
+		filtered, err := h.ngc.Filter(filters)
+		if err != nil {
+			h.logger.Warn("couldn't create filtered collector", "err", err)
+			http.Error(w, fmt.Sprintf("couldn't create filtered collector: %s", err), http.StatusBadRequest)
+			return
+		}
+		served = filtered
+	}
+
+	ctx := req.Context()
+	if timeout, ok := h.scrapeTimeout(req); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	gatherer, err := h.gatherer(ctx, served)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't create collector: %s", err)
+		h.logger.Error("couldn't register nvidia gpu collector", "err", err)
+		http.Error(w, fmt.Sprintf("couldn't register nvidia gpu collector: %s", err), http.StatusInternalServerError)
+		return
 	}
+	promhttp.HandlerFor(
+		gatherer,
+		promhttp.HandlerOpts{
+			ErrorLog:      slog.NewLogLogger(h.logger.Handler(), slog.LevelError),
+			ErrorHandling: promhttp.ContinueOnError,
+		},
+	).ServeHTTP(w, req)
+}
 
+// gatherer returns the metrics of served as exposed, i.e. with the hostname
+// label, compatibility metrics and metric filter applied.
+func (h *metricsHandler) gatherer(ctx context.Context, served collector.ContextCollector) (prometheus.Gatherer, error) {
 	r := prometheus.NewRegistry()
 	r.MustRegister(versioncollector.NewCollector("nvidia_gpu_exporter"))
-	if err := r.Register(ngc); err != nil {
-		return nil, fmt.Errorf("couldn't register nvidia gpu collector: %s", err)
+	if err := r.Register(collector.WithContext(ctx, served)); err != nil {
+		return nil, err
 	}
 
-	return promhttp.HandlerFor(
-		r,
-		promhttp.HandlerOpts{
-			ErrorLog:            slog.NewLogLogger(logger.Handler(), slog.LevelError),
-			ErrorHandling:       promhttp.ContinueOnError,
-			MaxRequestsInFlight: maxRequests,
-		},
-	), nil
+	var gatherer prometheus.Gatherer = r
+	if !h.hostnameLabel {
+		gatherer = withoutLabel(gatherer, "hostname")
+	}
+	for _, compat := range h.compat {
+		gatherer = compat(gatherer)
+	}
+	return h.filter.Load().gatherer(gatherer), nil
+}
+
+// dump collects the metrics of ngc once and writes them to w in the text
+// format. Metrics that could be gathered are written even if others failed.
+func (h *metricsHandler) dump(ctx context.Context, w io.Writer) error {
+	gatherer, err := h.gatherer(ctx, h.ngc)
+	if err != nil {
+		return err
+	}
+	families, gatherErr := gatherer.Gather()
+	enc := expfmt.NewEncoder(w, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			return err
+		}
+	}
+	return gatherErr
+}
+
+// metricFilter drops metric families whose names don't match include or
+// match exclude. Nil expressions don't drop anything.
+type metricFilter struct {
+	include, exclude *regexp.Regexp
+}
+
+// newMetricFilter compiles the include and exclude expressions, which must
+// match whole metric names.
+func newMetricFilter(include, exclude string) (metricFilter, error) {
+	var f metricFilter
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile("^(?:" + include + ")$"); err != nil {
+			return f, fmt.Errorf("include: %w", err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile("^(?:" + exclude + ")$"); err != nil {
+			return f, fmt.Errorf("exclude: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func (f metricFilter) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	if f.include == nil && f.exclude == nil {
+		return g
+	}
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		kept := families[:0]
+		for _, family := range families {
+			name := family.GetName()
+			if f.include != nil && !f.include.MatchString(name) {
+				continue
+			}
+			if f.exclude != nil && f.exclude.MatchString(name) {
+				continue
+			}
+			kept = append(kept, family)
+		}
+		return kept, err
+	})
+}
+
+// withoutLabel removes the label name from all metrics gathered by g. The
+// label must have the same value on all metrics of a family, like hostname.
+func withoutLabel(g prometheus.Gatherer, name string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				metric.Label = slices.DeleteFunc(metric.Label, func(label *dto.LabelPair) bool {
+					return label.GetName() == name
+				})
+			}
+		}
+		return families, err
+	})
+}
+
+// scrapeTimeout returns the scrape timeout sent by Prometheus less the
+// configured offset, which leaves time to encode and send the response.
+func (h *metricsHandler) scrapeTimeout(req *http.Request) (time.Duration, bool) {
+	header := req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		h.logger.Debug("ignoring invalid scrape timeout header", "value", header)
+		return 0, false
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > h.timeoutOffset {
+		timeout -= h.timeoutOffset
+	}
+	return timeout, true
+}
+
+// newCollectorLoggers builds a dedicated logger for every collector with a
+// log level override, sharing the output format of the global logger.
+func newCollectorLoggers(levels map[string]string, base *promslog.Config) (map[string]*slog.Logger, error) {
+	loggers := make(map[string]*slog.Logger, len(levels))
+	for name, lvl := range levels {
+		level := promslog.NewLevel()
+		if err := level.Set(lvl); err != nil {
+			return nil, fmt.Errorf("collector %q: %w", name, err)
+		}
+		loggers[name] = promslog.New(&promslog.Config{
+			Level:  level,
+			Format: base.Format,
+			Style:  base.Style,
+			Writer: base.Writer,
+		})
+	}
+	return loggers, nil
+}
+
+// readinessCheck returns the readiness criterion selected by mode.
+func readinessCheck(mode string, collections int64, ngc *collector.NvidiaGPUCollector) func() error {
+	switch mode {
+	case "enumeration":
+		return func() error {
+			if !ngc.Enumerated() {
+				return errors.New("GPUs have not been enumerated yet")
+			}
+			return nil
+		}
+	case "collections":
+		return func() error {
+			if n := ngc.ConsecutiveSuccesses(); n < collections {
+				return fmt.Errorf("%d of %d required consecutive collections succeeded", n, collections)
+			}
+			return nil
+		}
+	default:
+		return func() error { return nil }
+	}
 }
 
 func main() {
@@ -58,32 +278,314 @@ func main() {
 			"web.max-requests",
 			"Maximum number of parallel scrape requests. Use 0 to disable.",
 		).Default("40").Int()
+		scrapeTimeoutOffset = kingpin.Flag(
+			"web.scrape-timeout-offset",
+			"Offset to subtract from the scrape timeout sent by Prometheus, leaving time to send the response. Collectors still running at the shortened timeout are reported as failed.",
+		).Default("500ms").Duration()
+		includeMetrics = kingpin.Flag(
+			"web.include-metrics",
+			"Regular expression matching the whole names of the metrics to expose. All metrics are exposed if unset.",
+		).String()
+		excludeMetrics = kingpin.Flag(
+			"web.exclude-metrics",
+			"Regular expression matching the whole names of metrics not to expose, e.g. gpu_process_.* to drop the per-process series. Applied after --web.include-metrics.",
+		).String()
+		hostname = kingpin.Flag(
+			"hostname",
+			"Value of the hostname label. Defaults to the NODE_NAME environment variable, or else the hostname.",
+		).String()
+		hostnameLabel = kingpin.Flag(
+			"hostname-label",
+			"Add the hostname label to metrics. Disable it when the instance label already identifies the node.",
+		).Default("true").Bool()
+		dcgmCompat = kingpin.Flag(
+			"web.dcgm-exporter-compat",
+			"Also expose the metrics dcgm-exporter has equivalents for under its DCGM_FI_* names, units and labels, so existing dashboards and alerts keep working during a migration. Use --web.exclude-metrics to drop the native metrics.",
+		).Default("false").Bool()
+		nvidiaSMICompat = kingpin.Flag(
+			"web.nvidia-smi-exporter-compat",
+			"Also expose the metrics nvidia_smi_exporter has equivalents for under its nvidia_smi_* names, units and labels, for users switching from that exporter.",
+		).Default("false").Bool()
+		once = kingpin.Flag(
+			"once",
+			"Collect metrics once, print them to stdout in the Prometheus text format and exit instead of serving them.",
+		).Default("false").Bool()
+		textfilePath = kingpin.Flag(
+			"textfile.path",
+			"Periodically write the metrics to this file, e.g. <dir>/nvidia_gpu.prom in the directory of node_exporter's textfile collector. The file is replaced atomically.",
+		).String()
+		textfileInterval = kingpin.Flag(
+			"textfile.interval",
+			"Interval at which the metrics are written to --textfile.path.",
+		).Default("1m").Duration()
+		webDisable = kingpin.Flag(
+			"web.disable",
+			"Don't serve metrics over HTTP, e.g. when they are only written to --textfile.path.",
+		).Default("false").Bool()
+		configFile = kingpin.Flag(
+			"config.file",
+			"File of flags, one per line as on the command line, that take precedence over the command line and are read again on SIGHUP or POST /-/reload. It may only set --[no-]collector.<name>, --collector.gpu.include, --collector.gpu.exclude, --web.include-metrics, --web.exclude-metrics and --log.level.",
+		).String()
+		configCheck = kingpin.Flag(
+			"config.check",
+			"Validate the configuration files, metric filters and other flags, then exit without starting the server. Exits nonzero if the configuration is invalid.",
+		).Default("false").Bool()
+		backend = kingpin.Flag(
+			"backend",
+			"Where GPU metrics come from: nvidia queries DCGM and NVML, mock synthesizes plausible metrics without NVIDIA hardware for development.",
+		).Default("nvidia").Enum("nvidia", "mock")
+		mockGPUs = kingpin.Flag(
+			"backend.mock-gpus",
+			"Number of GPUs the mock backend reports.",
+		).Default("4").Int()
+		disableDefaultCollectors = kingpin.Flag(
+			"collector.disable-defaults",
+			"Disable all collectors not explicitly enabled with --collector.<name>.",
+		).Default("false").Bool()
+		pollInterval = kingpin.Flag(
+			"collector.poll-interval",
+			"Collect metrics in the background at this interval and serve the latest snapshot on scrape, instead of collecting on every scrape. 0 disables polling.",
+		).Default("0s").Duration()
+		collectorLogLevels = kingpin.Flag(
+			"log.collector-level",
+			"Override the log level for a single collector, as <collector>=<level>. Can be repeated.",
+		).PlaceHolder("<collector>=<level>").StringMap()
+		tlsCertFile = kingpin.Flag(
+			"web.tls-cert-file",
+			"Path to the TLS certificate. Enables HTTPS together with --web.tls-key-file. Reloaded on change.",
+		).String()
+		tlsKeyFile = kingpin.Flag(
+			"web.tls-key-file",
+			"Path to the TLS private key. Reloaded on change.",
+		).String()
+		bearerTokenFile = kingpin.Flag(
+			"web.bearer-token-file",
+			"Path to a file containing the bearer token required to access the exporter. Reloaded on change.",
+		).String()
+		readinessMode = kingpin.Flag(
+			"web.readiness-mode",
+			"When /-/ready reports ready: http (as soon as the server is up), enumeration (after GPUs were listed once) or collections (while the last --web.readiness-collections collections succeeded).",
+		).Default("http").Enum("http", "enumeration", "collections")
+		readinessCollections = kingpin.Flag(
+			"web.readiness-collections",
+			"Number of consecutive successful collections required by --web.readiness-mode=collections.",
+		).Default("1").Int64()
 	)
 
+	kingpin.Command("serve", "Serve GPU metrics. The default command.").Default()
+	doctorCmd := kingpin.Command("doctor", "Check that the driver, device nodes, NVML and DCGM allow collecting GPU metrics. Exits nonzero if a check fails.")
+	healthcheckCmd := kingpin.Command("healthcheck", "Query /-/ready of the exporter running on this host with the same flags and exit nonzero unless it is ready, e.g. for a Docker HEALTHCHECK.")
+	healthcheckURLFlag := healthcheckCmd.Flag("url", "URL to query instead of /-/ready at --web.listen-address.").Envar("NVIDIA_GPU_EXPORTER_HEALTHCHECK_URL").String()
+	healthcheckTimeout := healthcheckCmd.Flag("timeout", "Timeout of the query.").Envar("NVIDIA_GPU_EXPORTER_HEALTHCHECK_TIMEOUT").Default("5s").Duration()
+	listCollectorsCmd := kingpin.Command("list-collectors", "List the collectors, whether they are enabled with the given flags and the metrics they can export.")
+
 	promslogConfig := &promslog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promslogConfig)
 	kingpin.CommandLine.UsageWriter(os.Stdout)
+	// Every flag can also be set by environment variable, e.g.
+	// NVIDIA_GPU_EXPORTER_WEB_LISTEN_ADDRESS for --web.listen-address,
+	// regardless of the name the binary was installed under.
+	kingpin.CommandLine.Name = "nvidia-gpu-exporter"
+	kingpin.CommandLine.DefaultEnvars()
+	kingpin.HelpFlag.NoEnvar()
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
 	logger := promslog.New(promslogConfig)
+	if *disableDefaultCollectors {
+		collector.DisableDefaultCollectors()
+	}
+	switch command {
+	case doctorCmd.FullCommand():
+		os.Exit(runDoctor(os.Stdout, logger))
+	case healthcheckCmd.FullCommand():
+		url := *healthcheckURLFlag
+		if url == "" {
+			var err error
+			if url, err = healthcheckURL(*listenAddress, *tlsCertFile != ""); err != nil {
+				logger.Error("unhealthy", "err", err)
+				os.Exit(1)
+			}
+		}
+		if err := healthcheck(url, *healthcheckTimeout); err != nil {
+			logger.Error("unhealthy", "url", url, "err", err)
+			os.Exit(1)
+		}
+		return
+	case listCollectorsCmd.FullCommand():
+		if err := listCollectors(os.Stdout, logger); err != nil {
+			logger.Error("failed to list collectors", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *configCheck {
+		errs := []error{collector.CheckConfig()}
+		if _, err := newMetricFilter(*includeMetrics, *excludeMetrics); err != nil {
+			errs = append(errs, fmt.Errorf("metric filter: %w", err))
+		}
+		if _, err := newCollectorLoggers(*collectorLogLevels, promslogConfig); err != nil {
+			errs = append(errs, fmt.Errorf("collector log level: %w", err))
+		}
+		if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+			errs = append(errs, errors.New("--web.tls-cert-file and --web.tls-key-file must be set together"))
+		}
+		if *textfilePath != "" && *textfileInterval <= 0 {
+			errs = append(errs, errors.New("--textfile.interval must be positive"))
+		}
+		if *configFile != "" {
+			errs = append(errs, newConfigReloader(*configFile, *includeMetrics, *excludeMetrics, promslogConfig.Level).check())
+		}
+		if err := errors.Join(errs...); err != nil {
+			logger.Error("invalid configuration", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("configuration is valid")
+		return
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	metricsHandler, err := newHandler(*maxRequests, logger)
+	collectorLoggers, err := newCollectorLoggers(*collectorLogLevels, promslogConfig)
+	if err != nil {
+		logger.Error("invalid collector log level", "err", err)
+		os.Exit(1)
+	}
+
+	if *backend == "mock" {
+		logger.Warn("reporting synthetic metrics of mock GPUs", "gpus", *mockGPUs)
+		collector.UseMockBackend(*mockGPUs)
+	}
+
+	node, err := collector.ResolveNodeName(*hostname, os.Getenv("NODE_NAME"), os.Hostname)
+	if err != nil {
+		logger.Warn("failed to determine hostname", "hostname", node, "err", err)
+	}
+
+	ngc, err := collector.NewNvidiaGPUCollector(logger, node, collectorLoggers)
 	if err != nil {
-		logger.Error("failed to create metrics handler", "err", err)
+		logger.Error("couldn't create collector", "err", err)
 		os.Exit(1)
 	}
+	if *backend == "nvidia" {
+		collector.InitDCGM(logger)
+		defer collector.ShutdownDCGM()
+		defer collector.ShutdownNVML(logger)
+	}
+
+	var served collector.ContextCollector = ngc
+	if *pollInterval > 0 && !*once {
+		snapshot := collector.NewSnapshotCollector(ngc, logger)
+		go snapshot.Run(ctx, *pollInterval)
+		served = snapshot
+	}
+
+	filter, err := newMetricFilter(*includeMetrics, *excludeMetrics)
+	if err != nil {
+		logger.Error("invalid metric filter", "err", err)
+		os.Exit(1)
+	}
+
+	var compat []func(prometheus.Gatherer) prometheus.Gatherer
+	if *dcgmCompat {
+		compat = append(compat, collector.DCGMExporterCompat)
+	}
+	if *nvidiaSMICompat {
+		compat = append(compat, collector.NvidiaSMIExporterCompat)
+	}
+
+	handler := newHandler(served, ngc, filter, *hostnameLabel, compat, *maxRequests, *scrapeTimeoutOffset, logger)
+	config := newConfigReloader(*configFile, *includeMetrics, *excludeMetrics, promslogConfig.Level)
+	if *configFile != "" {
+		if err := config.reload(ngc, handler); err != nil {
+			logger.Error("invalid config file", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *once {
+		if err := handler.dump(ctx, os.Stdout); err != nil {
+			logger.Error("failed to collect metrics", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *textfilePath != "" {
+		if *textfileInterval <= 0 {
+			logger.Error("--textfile.interval must be positive")
+			os.Exit(1)
+		}
+		logger.Info("writing metrics to textfile", "path", *textfilePath, "interval", *textfileInterval)
+		go runTextfile(ctx, handler, *textfilePath, *textfileInterval, logger)
+	}
+
+	var metricsHandler http.Handler = handler
+
+	var token *web.SecretFile
+	if *bearerTokenFile != "" {
+		token, err = web.NewSecretFile(*bearerTokenFile)
+		if err != nil {
+			logger.Error("failed to load bearer token", "err", err)
+			os.Exit(1)
+		}
+		metricsHandler = web.BearerAuth(metricsHandler, token, logger)
+	}
+
+	reload := func() error {
+		if err := config.reload(ngc, handler); err != nil {
+			logger.Error("failed to reload configuration", "err", err)
+			return err
+		}
+		logger.Info("reloaded configuration")
+		return nil
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				_ = reload()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if *webDisable {
+		<-ctx.Done()
+		logger.Info("exporter stopped")
+		return
+	}
 
 	mux := http.NewServeMux()
 	mux.Handle(*metricsPath, metricsHandler)
+	var reloadHandler http.Handler = web.ReloadHandler(reload)
+	if *bearerTokenFile != "" {
+		reloadHandler = web.BearerAuth(reloadHandler, token, logger)
+	}
+	mux.Handle("/-/reload", reloadHandler)
+	mux.Handle("/-/ready", web.ReadyHandler(readinessCheck(*readinessMode, *readinessCollections, ngc)))
 
 	server := &http.Server{
 		Addr:    *listenAddress,
 		Handler: mux,
 	}
 
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		logger.Error("--web.tls-cert-file and --web.tls-key-file must be set together")
+		os.Exit(1)
+	}
+	if *tlsCertFile != "" {
+		keyPair, err := web.NewKeyPair(*tlsCertFile, *tlsKeyFile, logger)
+		if err != nil {
+			logger.Error("failed to load TLS key pair", "err", err)
+			os.Exit(1)
+		}
+		server.TLSConfig = keyPair.TLSConfig()
+	}
+
 	go func() {
 		<-ctx.Done()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -93,8 +595,13 @@ func main() {
 		}
 	}()
 
-	logger.Info("starting exporter", "addr", *listenAddress, "metrics_path", *metricsPath)
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	logger.Info("starting exporter", "addr", *listenAddress, "metrics_path", *metricsPath, "tls", server.TLSConfig != nil)
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Error("server error", "err", err)
 		os.Exit(1)
 	}
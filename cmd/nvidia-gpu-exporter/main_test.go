@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricFilter(t *testing.T) {
+	names := []string{"gpu_metrics_temperature", "gpu_metrics_gpu_utilization", "gpu_power_usage", "gpu_exporter_dcgm_restarts_total"}
+	for _, tc := range []struct {
+		name             string
+		include, exclude string
+		want             []string
+		wantErr          bool
+	}{
+		{name: "no filter", want: names},
+		{name: "include", include: "gpu_metrics_.*", want: names[:2]},
+		{name: "include whole names only", include: "gpu_metrics", want: []string{}},
+		{name: "include alternatives", include: "gpu_power_usage|gpu_metrics_temperature", want: []string{"gpu_metrics_temperature", "gpu_power_usage"}},
+		{name: "exclude", exclude: "gpu_exporter_.*", want: names[:3]},
+		{name: "exclude after include", include: "gpu_metrics_.*", exclude: ".*_utilization", want: []string{"gpu_metrics_temperature"}},
+		{name: "invalid include", include: "(", wantErr: true},
+		{name: "invalid exclude", exclude: "[", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := newMetricFilter(tc.include, tc.exclude)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newMetricFilter() error = %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			families, err := f.gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+				families := make([]*dto.MetricFamily, 0, len(names))
+				for _, name := range names {
+					families = append(families, &dto.MetricFamily{Name: &name})
+				}
+				return families, nil
+			})).Gather()
+			if err != nil {
+				t.Fatalf("Gather() error = %v", err)
+			}
+			got := make([]string, 0, len(families))
+			for _, family := range families {
+				got = append(got, family.GetName())
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Gather() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
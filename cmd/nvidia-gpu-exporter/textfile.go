@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// runTextfile writes the metrics served by h to path every interval until ctx
+// is done, for node_exporter's textfile collector to pick up.
+func runTextfile(ctx context.Context, h *metricsHandler, path string, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		writeCtx, cancel := context.WithTimeout(ctx, interval)
+		if err := h.writeTextfile(writeCtx, path); err != nil {
+			logger.Warn("failed to write textfile", "path", path, "err", err)
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeTextfile collects the metrics served by h and replaces path with them
+// atomically, so the textfile collector never reads a partial file. Metrics
+// that could be gathered are written even if others failed. Timestamps are
+// dropped, as the textfile collector rejects files that carry them.
+func (h *metricsHandler) writeTextfile(ctx context.Context, path string) error {
+	gatherer, err := h.gatherer(ctx, h.collector)
+	if err != nil {
+		return err
+	}
+	families, gatherErr := gatherer.Gather()
+
+	// The textfile collector only reads files ending in .prom, so it skips
+	// the temporary file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := expfmt.NewEncoder(tmp, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			m.TimestampMs = nil
+		}
+		if err := enc.Encode(family); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return gatherErr
+}
@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"log/slog"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// deviceBackend lists the GPUs of the node. Collectors reach DCGM and NVML
+// through it instead of calling the libraries directly, so another
+// implementation can be swapped in, e.g. by tests. NVML device handles are
+// nvml.Device interfaces, which fakes can implement as well.
+type deviceBackend interface {
+	// dcgmGPUs returns the GPUs DCGM supports with the latest values of
+	// fields. Their labels are left empty.
+	dcgmGPUs(logger *slog.Logger, fields []dcgm.Short) ([]dcgmGPU, error)
+	// nvmlGPUs returns the GPUs NVML reports.
+	nvmlGPUs(logger *slog.Logger) ([]nvmlGPU, error)
+	// confComputeState returns the system-wide confidential computing
+	// state and whether the GPUs accept client requests. It must be called
+	// after nvmlGPUs.
+	confComputeState() (state nvml.ConfComputeSystemState, stateRet nvml.Return, accepting uint32, readyRet nvml.Return)
+	// gpuFabricInfo returns the fabric registration of a GPU returned by
+	// nvmlGPUs. The versioned NVML query isn't part of nvml.Device, so fakes
+	// can't implement it there.
+	gpuFabricInfo(device nvml.Device) (nvml.GpuFabricInfo_v2, nvml.Return)
+}
+
+// processBackend lists the processes running on the GPUs of the node.
+type processBackend interface {
+	// gpuProcesses returns the processes per GPU, sorted by GPU and PID.
+	gpuProcesses(logger *slog.Logger) ([]gpuProcessUsage, error)
+}
+
+// libraryBackend implements the backends on top of the DCGM and NVML
+// libraries. Callers hold the matching DCGM or NVML slot.
+type libraryBackend struct{}
+
+// The backends used by collectors.
+var (
+	gpuBackend  deviceBackend  = instrumentedBackend{devices: libraryBackend{}}
+	procBackend processBackend = instrumentedBackend{processes: libraryBackend{}}
+)
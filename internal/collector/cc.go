@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUConfComputeSubsystem = "confidential_compute"
+)
+
+// gpuConfComputeCollector exports the confidential computing mode of Hopper
+// and later GPUs so its rollout can be audited. NVML reports the mode for the
+// whole system, as all GPUs of a node must share it; it is exported per GPU
+// so it can be joined with the other GPU metrics.
+type gpuConfComputeCollector struct {
+	enabled      *prometheus.Desc
+	devToolsMode *prometheus.Desc
+	ready        *prometheus.Desc
+	logger       *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_confidential_compute", NewGPUConfComputeCollector)
+}
+
+func NewGPUConfComputeCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuConfComputeCollector{
+		enabled: newDesc(
+			prometheus.BuildFQName(namespace, GPUConfComputeSubsystem, "enabled"),
+			"Whether confidential computing mode is enabled.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		devToolsMode: newDesc(
+			prometheus.BuildFQName(namespace, GPUConfComputeSubsystem, "devtools_mode"),
+			"Whether confidential computing devtools mode is enabled, which allows debugging and profiling at the cost of protection.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		ready: newDesc(
+			prometheus.BuildFQName(namespace, GPUConfComputeSubsystem, "ready"),
+			"Whether the GPUs accept work in confidential computing mode.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuConfComputeCollector) Update(ch chan<- prometheus.Metric) error {
+	// The state can only be read once NVML is initialized, so it is queried
+	// with the first GPU.
+	var (
+		queried   bool
+		state     nvml.ConfComputeSystemState
+		stateRet  nvml.Return
+		accepting uint32
+		readyRet  nvml.Return
+	)
+	return collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		if !queried {
+			queried = true
+			state, stateRet, accepting, readyRet = gpuBackend.confComputeState()
+			if stateRet != nvml.SUCCESS {
+				c.logger.Debug("failed to read confidential compute state", "err", nvml.ErrorString(stateRet))
+			}
+		}
+		if stateRet != nvml.SUCCESS {
+			return
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.enabled, prometheus.GaugeValue,
+			boolToFloat(state.CcFeature == nvml.CC_SYSTEM_FEATURE_ENABLED), gpu.labels...)
+		ch <- prometheus.MustNewConstMetric(c.devToolsMode, prometheus.GaugeValue,
+			boolToFloat(state.DevToolsMode == nvml.CC_SYSTEM_DEVTOOLS_MODE_ON), gpu.labels...)
+		if state.CcFeature == nvml.CC_SYSTEM_FEATURE_ENABLED && readyRet == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(c.ready, prometheus.GaugeValue,
+				boolToFloat(accepting == nvml.CC_ACCEPTING_CLIENT_REQUESTS_TRUE), gpu.labels...)
+		}
+	})
+}
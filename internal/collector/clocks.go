@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUClocksSubsystem = "clocks"
+)
+
+type gpuClock struct {
+	name string
+	typ  nvml.ClockType
+}
+
+var gpuClockTypes = []gpuClock{
+	{"graphics", nvml.CLOCK_GRAPHICS},
+	{"sm", nvml.CLOCK_SM},
+	{"memory", nvml.CLOCK_MEM},
+	{"video", nvml.CLOCK_VIDEO},
+}
+
+// gpuClocksCollector exports the current, application and maximum clock
+// frequencies of each GPU.
+type gpuClocksCollector struct {
+	current     *prometheus.Desc
+	application *prometheus.Desc
+	max         *prometheus.Desc
+	logger      *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_clocks", NewGPUClocksCollector)
+}
+
+func NewGPUClocksCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuClocksCollector{
+		current: newDesc(
+			prometheus.BuildFQName(namespace, GPUClocksSubsystem, "current_hertz"),
+			"Current GPU clock frequency in hertz.",
+			[]string{"hostname", "gpu_id", "gpu_name", "clock"}, nil,
+		),
+		application: newDesc(
+			prometheus.BuildFQName(namespace, GPUClocksSubsystem, "application_hertz"),
+			"Configured GPU application clock frequency in hertz.",
+			[]string{"hostname", "gpu_id", "gpu_name", "clock"}, nil,
+		),
+		max: newDesc(
+			prometheus.BuildFQName(namespace, GPUClocksSubsystem, "max_hertz"),
+			"Maximum supported GPU clock frequency in hertz.",
+			[]string{"hostname", "gpu_id", "gpu_name", "clock"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuClocksCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if idleSuppressed(gpu.uuid) {
+			return
+		}
+		for _, clock := range gpuClockTypes {
+			c.emit(ch, c.current, "current", gpu, clock, gpu.device.GetClockInfo)
+			c.emit(ch, c.application, "application", gpu, clock, gpu.device.GetApplicationsClock)
+			c.emit(ch, c.max, "max", gpu, clock, gpu.device.GetMaxClockInfo)
+		}
+	})
+}
+
+// emit exports the clock frequency returned by read. Clocks the GPU doesn't
+// report, e.g. application clocks on consumer boards, are skipped.
+func (c *gpuClocksCollector) emit(ch chan<- prometheus.Metric, desc *prometheus.Desc, kind string, gpu nvmlGPU, clock gpuClock, read func(nvml.ClockType) (uint32, nvml.Return)) {
+	mhz, ret := read(clock.typ)
+	if ret != nvml.SUCCESS {
+		c.logger.Debug("failed to read clock", "gpu_index", gpu.index, "clock", clock.name, "kind", kind, "err", nvml.ErrorString(ret))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, mhzToHertz(mhz), withLabels(gpu.labels, clock.name)...)
+}
+
+func mhzToHertz(value uint32) float64 {
+	return float64(value) * 1e6
+}
@@ -1,16 +1,25 @@
 package collector
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const namespace = "gpu"
 
+var cacheTTL = kingpin.Flag(
+	"collector.cache-ttl",
+	"Serve the result of a collector from cache for this long after it ran, so scrapes by several Prometheus servers within a short window query DCGM and NVML only once. 0 disables caching.",
+).Default("0s").Duration()
+
 var (
 	scrapeDurationDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "scrape", "controller_duration_seconds"),
@@ -27,58 +36,225 @@ var (
 	factories              = make(map[string]func(logger *slog.Logger) (Collector, error))
 	initiatedCollectorsMtx = sync.Mutex{}
 	initiatedCollectors    = make(map[string]Collector)
-	collectorState         = make(map[string]bool)
+	collectorState         = make(map[string]*bool)
+	collectorFlags         = make(map[string]*kingpin.FlagClause)
+	forcedCollectors       = map[string]bool{} // collectors which have been explicitly enabled or disabled
 )
 
 func registerCollector(collector string, factory func(logger *slog.Logger) (Collector, error)) {
-	collectorState[collector] = true
+	flagName := fmt.Sprintf("collector.%s", collector)
+	flagHelp := fmt.Sprintf("Enable the %s collector (default: enabled).", collector)
+	flag := kingpin.Flag(flagName, flagHelp).Default("true").Action(collectorFlagAction(collector))
+	collectorState[collector] = flag.Bool()
+	collectorFlags[collector] = flag
 	factories[collector] = factory
 }
 
+// collectorFlagAction generates a new action function for the given collector
+// to track whether it has been explicitly enabled or disabled from the command line.
+// A new action function is needed for each collector flag because the ParseContext
+// does not contain information about which flag called the action.
+// See: https://github.com/alecthomas/kingpin/issues/294
+func collectorFlagAction(collector string) func(ctx *kingpin.ParseContext) error {
+	return func(ctx *kingpin.ParseContext) error {
+		forcedCollectors[collector] = true
+		return nil
+	}
+}
+
+// DisableDefaultCollectors sets the collector state to false for all collectors which
+// have not been explicitly enabled on the command line or by environment variable.
+// Flags set by environment variable don't run their action.
+func DisableDefaultCollectors() {
+	for c := range collectorState {
+		if _, ok := forcedCollectors[c]; !ok && !collectorFlags[c].HasEnvarValue() {
+			*collectorState[c] = false
+		}
+	}
+}
+
 type NvidiaGPUCollector struct {
-	Collectors map[string]Collector
-	logger     *slog.Logger
+	logger *slog.Logger
+	// loggers overrides the logger of collectors by name.
+	loggers map[string]*slog.Logger
+	status  *collectionStatus
+
+	// mtx guards collectors, which Reload replaces.
+	mtx        sync.RWMutex
+	collectors map[string]Collector
 }
 
-func NewNvidiaGPUCollector(logger *slog.Logger) (*NvidiaGPUCollector, error) {
+// nodeName is the hostname label value of all metrics. It is set by
+// NewNvidiaGPUCollector before any collector runs.
+var nodeName = unknownNodeName
+
+const unknownNodeName = "unknown"
+
+// ResolveNodeName returns the name of the node the exporter runs on: flag,
+// the value of --hostname, if set, then env, the NODE_NAME environment
+// variable set from the Kubernetes downward API, and else the hostname. If
+// none is available, it returns "unknown" along with the error of hostname.
+func ResolveNodeName(flag, env string, hostname func() (string, error)) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	if env != "" {
+		return env, nil
+	}
+	name, err := hostname()
+	if err != nil {
+		return unknownNodeName, err
+	}
+	if name == "" {
+		return unknownNodeName, nil
+	}
+	return name, nil
+}
+
+// NewNvidiaGPUCollector creates the enabled collectors, which label their
+// metrics with node as hostname. collectorLoggers optionally overrides the
+// logger of individual collectors by name, e.g. to run a single collector at
+// debug level.
+func NewNvidiaGPUCollector(logger *slog.Logger, node string, collectorLoggers map[string]*slog.Logger) (*NvidiaGPUCollector, error) {
+	for name := range collectorLoggers {
+		if _, ok := factories[name]; !ok {
+			return nil, fmt.Errorf("log level override for unknown collector %q", name)
+		}
+	}
+	nodeName = node
+
+	n := &NvidiaGPUCollector{logger: logger, loggers: collectorLoggers, status: &collectionStatus{}}
+	collectors, err := n.enabledCollectors(nil)
+	if err != nil {
+		return nil, err
+	}
+	n.collectors = collectors
+	return n, nil
+}
+
+// enabledCollectors returns the collectors enabled on the command line or by
+// o, creating those that didn't run before.
+func (n *NvidiaGPUCollector) enabledCollectors(o *Overrides) (map[string]Collector, error) {
 	collectors := make(map[string]Collector)
 	initiatedCollectorsMtx.Lock()
 	defer initiatedCollectorsMtx.Unlock()
-	for key, _ := range collectorState {
+	for key, enabled := range collectorState {
+		if !o.enabled(key, *enabled) {
+			continue
+		}
 		if collector, ok := initiatedCollectors[key]; ok {
 			collectors[key] = collector
-		} else {
-			collector, err := factories[key](logger.With("collector", key))
-			if err != nil {
-				return nil, err
+			continue
+		}
+		collector, err := factories[key](n.loggerFor(key).With("collector", key))
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := collector.(starter); ok {
+			if err := s.start(); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
 			}
-			collectors[key] = collector
-			initiatedCollectors[key] = collector
 		}
+		if *cacheTTL > 0 {
+			collector = &cachedCollector{Collector: collector, ttl: *cacheTTL}
+		}
+		collectors[key] = collector
+		initiatedCollectors[key] = collector
 	}
-	return &NvidiaGPUCollector{Collectors: collectors, logger: logger}, nil
+	return collectors, nil
 }
 
-func (n NvidiaGPUCollector) Describe(ch chan<- *prometheus.Desc) {
+func (n *NvidiaGPUCollector) loggerFor(name string) *slog.Logger {
+	if l, ok := n.loggers[name]; ok {
+		return l
+	}
+	return n.logger
+}
+
+// CheckConfig validates the configuration files and flags collectors read,
+// without initializing DCGM or NVML, so changes can be checked before they
+// are rolled out.
+func CheckConfig() error {
+	errs := []error{checkGPUFilter()}
+	if *dcgmFieldsConfig != "" {
+		_, err := readDCGMFieldsConfig(*dcgmFieldsConfig)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Filter returns a collector running only the named collectors, e.g. those
+// given in the collect[] parameter of a scrape. It fails for collectors that
+// don't exist or are disabled.
+func (n *NvidiaGPUCollector) Filter(names []string) (*NvidiaGPUCollector, error) {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+	collectors := make(map[string]Collector, len(names))
+	for _, name := range names {
+		c, ok := n.collectors[name]
+		if !ok {
+			if _, exists := factories[name]; exists {
+				return nil, fmt.Errorf("disabled collector: %s", name)
+			}
+			return nil, fmt.Errorf("missing collector: %s", name)
+		}
+		collectors[name] = c
+	}
+	return &NvidiaGPUCollector{collectors: collectors, logger: n.logger, loggers: n.loggers, status: n.status}, nil
+}
+
+func (n *NvidiaGPUCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- lastErrorDesc
+	ch <- deviceSuccessDesc
+	for _, c := range exporterMetrics {
+		c.Describe(ch)
+	}
 }
 
-func (n NvidiaGPUCollector) Collect(ch chan<- prometheus.Metric) {
+func (n *NvidiaGPUCollector) Collect(ch chan<- prometheus.Metric) {
+	n.CollectContext(context.Background(), ch)
+}
+
+// CollectContext runs all collectors concurrently until ctx is done.
+// Collectors still running by then are reported as failed and the rest of
+// their metrics is dropped. NVML and DCGM calls can't be interrupted, so
+// they are left to finish in the background.
+func (n *NvidiaGPUCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	n.mtx.RLock()
+	collectors := n.collectors
+	n.mtx.RUnlock()
+
+	begin := time.Now()
 	wg := sync.WaitGroup{}
-	wg.Add(len(n.Collectors))
-	for name, c := range n.Collectors {
+	wg.Add(len(collectors))
+	var failed atomic.Bool
+	for name, c := range collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, n.logger)
+			if err := execute(ctx, name, c, ch, n.loggerFor(name)); err != nil {
+				failed.Store(true)
+				if !IsNoDataError(err) {
+					n.status.lastErrors.record(name)
+				}
+			}
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
+	n.status.observe(!failed.Load())
+
+	n.status.lastErrors.collect(ch)
+	// Cached collectors may report on GPUs they saw up to cacheTTL ago.
+	collectDeviceStatus(ch, begin.Add(-*cacheTTL))
+	for _, c := range exporterMetrics {
+		c.Collect(ch)
+	}
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) {
+func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) error {
 	begin := time.Now()
-	err := c.Update(ch)
+	err := update(ctx, c, ch)
 	duration := time.Since(begin)
 	var success float64
 
@@ -95,12 +271,113 @@ func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	return err
+}
+
+// update forwards the metrics of c to ch until c is done or ctx is done,
+// whichever comes first.
+func update(ctx context.Context, c Collector, ch chan<- prometheus.Metric) error {
+	metrics := make(chan prometheus.Metric)
+	result := make(chan error, 1)
+	go func() {
+		result <- c.Update(metrics)
+		close(metrics)
+	}()
+	for {
+		select {
+		case metric, ok := <-metrics:
+			if !ok {
+				return <-result
+			}
+			ch <- metric
+		case <-ctx.Done():
+			// Let the abandoned collector run to completion.
+			go func() {
+				for range metrics {
+				}
+			}()
+			return fmt.Errorf("abandoned after scrape timeout: %w", ctx.Err())
+		}
+	}
+}
+
+// ContextCollector is a prometheus.Collector whose collection can be cut
+// short by a context, such as one carrying the Prometheus scrape timeout.
+type ContextCollector interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// WithContext returns c as a prometheus.Collector that collects until ctx
+// is done.
+func WithContext(ctx context.Context, c ContextCollector) prometheus.Collector {
+	return contextCollector{ContextCollector: c, ctx: ctx}
+}
+
+type contextCollector struct {
+	ContextCollector
+	ctx context.Context
 }
 
+func (c contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(c.ctx, ch)
+}
+
+// starter is implemented by collectors that work in the background. Their
+// factory only creates them, and start starts the work once the collector
+// is enabled, so that creating a collector has no side effects.
+type starter interface {
+	start() error
+}
+
+// Collector exports the metrics of one area. Update fails only when
+// nothing could be collected, e.g. because the library is unavailable. A
+// GPU that can't be queried is logged, marked with markDeviceFailed and left
+// out, while the other GPUs are still exported and Update succeeds.
 type Collector interface {
 	Update(ch chan<- prometheus.Metric) error
 }
 
+// cachedCollector replays the metrics and error of the last update of a
+// collector until ttl passed. Concurrent updates wait for the one in
+// progress instead of running the collector again.
+type cachedCollector struct {
+	Collector
+	ttl time.Duration
+
+	mtx     sync.Mutex
+	updated time.Time
+	metrics []prometheus.Metric
+	err     error
+}
+
+func (c *cachedCollector) Update(ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if time.Since(c.updated) >= c.ttl {
+		metrics := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		c.metrics = c.metrics[:0]
+		go func() {
+			for metric := range metrics {
+				c.metrics = append(c.metrics, metric)
+			}
+			close(done)
+		}()
+		c.err = c.Collector.Update(metrics)
+		close(metrics)
+		<-done
+		c.updated = time.Now()
+	}
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+	return c.err
+}
+
+// typedDesc ties a descriptor to its value type, so that cumulative fields
+// are always exported as counters and rate() works on them.
 type typedDesc struct {
 	desc      *prometheus.Desc
 	valueType prometheus.ValueType
@@ -110,6 +387,25 @@ func (d *typedDesc) mustNewConstMetric(value float64, labels ...string) promethe
 	return prometheus.MustNewConstMetric(d.desc, d.valueType, value, labels...)
 }
 
+// withLabels returns a copy of labels with extra appended, leaving the
+// shared per-GPU label slice untouched.
+func withLabels(labels []string, extra ...string) []string {
+	out := make([]string, 0, len(labels)+len(extra))
+	out = append(out, labels...)
+	return append(out, extra...)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func microsecondsToSeconds(value int64) float64 {
+	return float64(value) / 1e6
+}
+
 var ErrNoData = errors.New("collector returned no data")
 
 func IsNoDataError(err error) bool {
@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveNodeName(t *testing.T) {
+	errHostname := errors.New("no hostname")
+	for _, tc := range []struct {
+		name      string
+		flag, env string
+		hostname  string
+		hostErr   error
+		want      string
+		wantErr   error
+	}{
+		{name: "flag", flag: "flag-node", env: "env-node", hostname: "host", want: "flag-node"},
+		{name: "flag without hostname", flag: "flag-node", hostErr: errHostname, want: "flag-node"},
+		{name: "env", env: "env-node", hostname: "host", want: "env-node"},
+		{name: "env without hostname", env: "env-node", hostErr: errHostname, want: "env-node"},
+		{name: "hostname", hostname: "host", want: "host"},
+		{name: "hostname error", hostErr: errHostname, want: unknownNodeName, wantErr: errHostname},
+		{name: "empty hostname", want: unknownNodeName},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveNodeName(tc.flag, tc.env, func() (string, error) {
+				return tc.hostname, tc.hostErr
+			})
+			if got != tc.want || !errors.Is(err, tc.wantErr) {
+				t.Errorf("ResolveNodeName() = %q, %v, want %q, %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
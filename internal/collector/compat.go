@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// compatMetric maps an exporter metric, optionally only the series with the
+// given label value, to the metric with the same meaning in another exporter.
+// scale converts the value to the unit of that metric, and labels copies
+// native labels under another name.
+type compatMetric struct {
+	name         string
+	label, value string
+	scale        float64
+	labels       map[string]string
+}
+
+// compatLayer exposes metrics under the names of another exporter, so
+// dashboards and alerts built for it keep working during a migration.
+type compatLayer struct {
+	// metrics lists the metrics with an equivalent, by name.
+	metrics map[string][]compatMetric
+	// labels returns the labels of the other exporter for a series with the
+	// given native labels and the labels of the gpu_info series of its GPU.
+	labels func(labels, identity map[string]string) []*dto.LabelPair
+}
+
+// dcgmExporterLayer matches dcgm-exporter. Metrics dcgm-exporter aggregates
+// differently, like the ECC counters it sums over all memory locations, have
+// no equivalent.
+var dcgmExporterLayer = compatLayer{
+	metrics: map[string][]compatMetric{
+		"gpu_metrics_gpu_utilization":      {{name: "DCGM_FI_DEV_GPU_UTIL", scale: 1}},
+		"gpu_metrics_mem_copy_utilization": {{name: "DCGM_FI_DEV_MEM_COPY_UTIL", scale: 1}},
+		"gpu_metrics_encoder_utilization":  {{name: "DCGM_FI_DEV_ENC_UTIL", scale: 1}},
+		"gpu_metrics_decoder_utilization":  {{name: "DCGM_FI_DEV_DEC_UTIL", scale: 1}},
+		"gpu_metrics_free_memory":          {{name: "DCGM_FI_DEV_FB_FREE", scale: 1.0 / (1024 * 1024)}},
+		"gpu_metrics_used_memory":          {{name: "DCGM_FI_DEV_FB_USED", scale: 1.0 / (1024 * 1024)}},
+		"gpu_metrics_total_memory":         {{name: "DCGM_FI_DEV_FB_TOTAL", scale: 1.0 / (1024 * 1024)}},
+		"gpu_metrics_temperature":          {{name: "DCGM_FI_DEV_GPU_TEMP", scale: 1}},
+		"gpu_power_usage_watts":            {{name: "DCGM_FI_DEV_POWER_USAGE", scale: 1}},
+		"gpu_power_energy_joules_total":    {{name: "DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION", scale: 1000}},
+		"gpu_pcie_replays_total":           {{name: "DCGM_FI_DEV_PCIE_REPLAY_COUNTER", scale: 1}},
+		"gpu_row_remap_failure":            {{name: "DCGM_FI_DEV_ROW_REMAP_FAILURE", scale: 1}},
+		"gpu_clocks_current_hertz": {
+			{name: "DCGM_FI_DEV_SM_CLOCK", label: "clock", value: "sm", scale: 1e-6},
+			{name: "DCGM_FI_DEV_MEM_CLOCK", label: "clock", value: "memory", scale: 1e-6},
+		},
+		"gpu_throttle_violation_seconds_total": {
+			{name: "DCGM_FI_DEV_POWER_VIOLATION", label: "violation", value: "power", scale: 1e6},
+			{name: "DCGM_FI_DEV_THERMAL_VIOLATION", label: "violation", value: "thermal", scale: 1e6},
+		},
+		"gpu_row_remap_remapped_rows": {
+			{name: "DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS", label: "error_type", value: "correctable", scale: 1},
+			{name: "DCGM_FI_DEV_UNCORRECTABLE_REMAPPED_ROWS", label: "error_type", value: "uncorrectable", scale: 1},
+		},
+	},
+	labels: func(labels, identity map[string]string) []*dto.LabelPair {
+		var pairs []*dto.LabelPair
+		for name, compatName := range map[string]string{"hostname": "Hostname", "gpu_id": "gpu", "gpu_name": "modelName"} {
+			if value, ok := labels[name]; ok {
+				pairs = append(pairs, labelPair(compatName, value))
+			}
+		}
+		if id, ok := labels["gpu_id"]; ok {
+			pairs = append(pairs,
+				labelPair("UUID", identity["uuid"]),
+				labelPair("pci_bus_id", identity["pci_bus_id"]),
+				labelPair("device", "nvidia"+id),
+			)
+		}
+		return pairs
+	},
+}
+
+// nvidiaSMIExporterLayer matches nvidia_smi_exporter, which identifies GPUs
+// by the uuid label only and reports utilizations as ratios.
+var nvidiaSMIExporterLayer = compatLayer{
+	metrics: map[string][]compatMetric{
+		"gpu_info":                         {{name: "nvidia_smi_gpu_info", scale: 1, labels: map[string]string{"gpu_name": "name"}}},
+		"gpu_metrics_gpu_utilization":      {{name: "nvidia_smi_utilization_gpu_ratio", scale: 0.01}},
+		"gpu_metrics_mem_copy_utilization": {{name: "nvidia_smi_utilization_memory_ratio", scale: 0.01}},
+		"gpu_metrics_free_memory":          {{name: "nvidia_smi_memory_free_bytes", scale: 1}},
+		"gpu_metrics_used_memory":          {{name: "nvidia_smi_memory_used_bytes", scale: 1}},
+		"gpu_metrics_total_memory":         {{name: "nvidia_smi_memory_total_bytes", scale: 1}},
+		"gpu_metrics_temperature":          {{name: "nvidia_smi_temperature_gpu", scale: 1}},
+		"gpu_device_performance_state":     {{name: "nvidia_smi_pstate", scale: 1}},
+		"gpu_power_usage_watts":            {{name: "nvidia_smi_power_draw_watts", scale: 1}},
+		"gpu_power_limit_watts": {
+			{name: "nvidia_smi_power_limit_watts", label: "limit", value: "current", scale: 1},
+			{name: "nvidia_smi_enforced_power_limit_watts", label: "limit", value: "enforced", scale: 1},
+		},
+		"gpu_clocks_current_hertz": {
+			{name: "nvidia_smi_clocks_current_graphics_clock_hz", label: "clock", value: "graphics", scale: 1},
+			{name: "nvidia_smi_clocks_current_sm_clock_hz", label: "clock", value: "sm", scale: 1},
+			{name: "nvidia_smi_clocks_current_memory_clock_hz", label: "clock", value: "memory", scale: 1},
+			{name: "nvidia_smi_clocks_current_video_clock_hz", label: "clock", value: "video", scale: 1},
+		},
+		"gpu_clocks_max_hertz": {
+			{name: "nvidia_smi_clocks_max_graphics_clock_hz", label: "clock", value: "graphics", scale: 1},
+			{name: "nvidia_smi_clocks_max_sm_clock_hz", label: "clock", value: "sm", scale: 1},
+			{name: "nvidia_smi_clocks_max_memory_clock_hz", label: "clock", value: "memory", scale: 1},
+		},
+	},
+	labels: func(labels, identity map[string]string) []*dto.LabelPair {
+		return []*dto.LabelPair{labelPair("uuid", identity["uuid"])}
+	},
+}
+
+// DCGMExporterCompat adds the metrics gathered by g that dcgm-exporter has
+// equivalents for under dcgm-exporter's metric names, units and labels. The
+// UUID and pci_bus_id labels are taken from gpu_info and left empty without
+// the gpu_device collector.
+func DCGMExporterCompat(g prometheus.Gatherer) prometheus.Gatherer {
+	return dcgmExporterLayer.gatherer(g)
+}
+
+// NvidiaSMIExporterCompat adds the metrics gathered by g that
+// nvidia_smi_exporter has equivalents for under its metric names, units and
+// labels. The uuid label is taken from gpu_info and left empty without the
+// gpu_device collector.
+func NvidiaSMIExporterCompat(g prometheus.Gatherer) prometheus.Gatherer {
+	return nvidiaSMIExporterLayer.gatherer(g)
+}
+
+func (l compatLayer) gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+
+		identities := make(map[string]map[string]string)
+		for _, family := range families {
+			if family.GetName() != prometheus.BuildFQName(namespace, "", "info") {
+				continue
+			}
+			for _, metric := range family.Metric {
+				labels := labelMap(metric)
+				identities[labels["gpu_id"]] = labels
+			}
+		}
+
+		compat := make(map[string]*dto.MetricFamily)
+		for _, family := range families {
+			for _, mapping := range l.metrics[family.GetName()] {
+				for _, metric := range family.Metric {
+					labels := labelMap(metric)
+					if mapping.label != "" && labels[mapping.label] != mapping.value {
+						continue
+					}
+					out, ok := compat[mapping.name]
+					if !ok {
+						name := mapping.name
+						help := "Compatible " + family.GetName() + "."
+						out = &dto.MetricFamily{
+							Name: &name,
+							Help: &help,
+							Type: family.Type,
+						}
+						compat[mapping.name] = out
+					}
+					pairs := l.labels(labels, identities[labels["gpu_id"]])
+					for name, compatName := range mapping.labels {
+						pairs = append(pairs, labelPair(compatName, labels[name]))
+					}
+					out.Metric = append(out.Metric, compatMetricOf(metric, pairs, mapping.scale))
+				}
+			}
+		}
+		for _, family := range compat {
+			families = append(families, family)
+		}
+		slices.SortFunc(families, func(a, b *dto.MetricFamily) int {
+			return strings.Compare(a.GetName(), b.GetName())
+		})
+		return families, err
+	})
+}
+
+// compatMetricOf returns a copy of metric with the given labels and its value
+// scaled.
+func compatMetricOf(metric *dto.Metric, labels []*dto.LabelPair, scale float64) *dto.Metric {
+	slices.SortFunc(labels, func(a, b *dto.LabelPair) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
+
+	out := &dto.Metric{Label: labels, TimestampMs: metric.TimestampMs}
+	switch {
+	case metric.Counter != nil:
+		value := metric.Counter.GetValue() * scale
+		out.Counter = &dto.Counter{Value: &value}
+	case metric.Gauge != nil:
+		value := metric.Gauge.GetValue() * scale
+		out.Gauge = &dto.Gauge{Value: &value}
+	case metric.Untyped != nil:
+		value := metric.Untyped.GetValue() * scale
+		out.Untyped = &dto.Untyped{Value: &value}
+	}
+	return out
+}
+
+func labelMap(metric *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(metric.Label))
+	for _, label := range metric.Label {
+		labels[label.GetName()] = label.GetValue()
+	}
+	return labels
+}
+
+func labelPair(name, value string) *dto.LabelPair {
+	return &dto.LabelPair{Name: &name, Value: &value}
+}
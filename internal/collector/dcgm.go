@@ -0,0 +1,519 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dcgmMode = kingpin.Flag(
+		"dcgm.mode",
+		"How to reach DCGM: embedded starts a host engine inside the exporter, standalone connects to a running nv-hostengine at --dcgm.address.",
+	).Default("embedded").Enum("embedded", "standalone")
+	dcgmAddress = kingpin.Flag(
+		"dcgm.address",
+		"Address of the nv-hostengine to connect to in standalone mode, as host:port or the path of its unix socket.",
+	).Default("localhost:5555").String()
+	dcgmTimestamps = kingpin.Flag(
+		"collector.dcgm.timestamps",
+		"Attach the time DCGM sampled a field to the samples exported from it, instead of leaving the scrape time to Prometheus. Useful with --collector.poll-interval to see the age of a sample.",
+	).Default("false").Bool()
+	dcgmUpdateFrequency = kingpin.Flag(
+		"collector.dcgm.update-frequency",
+		"How often DCGM samples the watched fields in the background. Collections read the latest sample, so shorter intervals give fresher values at the cost of more CPU time in the host engine.",
+	).Default("30s").Duration()
+	dcgmMaxKeepAge = kingpin.Flag(
+		"collector.dcgm.max-keep-age",
+		"How long DCGM keeps the samples of a watched field, 0 to only limit them by --collector.dcgm.max-keep-samples.",
+	).Default("0s").Duration()
+	dcgmMaxKeepSamples = kingpin.Flag(
+		"collector.dcgm.max-keep-samples",
+		"How many samples of a watched field DCGM keeps, 0 to only limit them by --collector.dcgm.max-keep-age.",
+	).Default("1").Int32()
+	dcgmRestartAfter = kingpin.Flag(
+		"collector.dcgm.restart-after",
+		"Number of consecutive collections failing to list the GPUs after which the embedded DCGM host engine is restarted, or the standalone one reconnected to. 0 disables restarts.",
+	).Default("3").Int()
+)
+
+// Failed DCGM initializations are retried with exponential backoff between
+// these bounds.
+const (
+	dcgmInitMinBackoff = time.Second
+	dcgmInitMaxBackoff = 5 * time.Minute
+)
+
+// errDCGMUnavailable is returned when DCGM can't be initialized, e.g. because
+// libdcgm isn't installed or nv-hostengine can't be reached.
+var errDCGMUnavailable = errors.New("dcgm unavailable")
+
+// dcgmSession holds the embedded DCGM host engine, or the connection to a
+// standalone one, which is set up once and shared by all collectors, as
+// starting an engine takes hundreds of milliseconds.
+var dcgmSession struct {
+	mtx     sync.Mutex
+	cleanup func()
+	// listFailures counts consecutive failures to list the GPUs.
+	listFailures int
+	// initFailures counts consecutive failed initializations, the next of
+	// which is attempted at retryAt.
+	initFailures int
+	retryAt      time.Time
+}
+
+// dcgmInit starts the embedded DCGM host engine or connects to the standalone
+// one, unless that happened already. Failed attempts are retried on later
+// calls with exponential backoff.
+func dcgmInit() error {
+	dcgmSession.mtx.Lock()
+	defer dcgmSession.mtx.Unlock()
+
+	if dcgmSession.cleanup != nil {
+		return nil
+	}
+	if wait := time.Until(dcgmSession.retryAt); wait > 0 {
+		return fmt.Errorf("dcgm init: %w (retrying in %s)", errDCGMUnavailable, wait.Round(time.Second))
+	}
+	var (
+		cleanup func()
+		err     error
+	)
+	switch *dcgmMode {
+	case "standalone":
+		isSocket := "0"
+		if strings.HasPrefix(*dcgmAddress, "/") {
+			isSocket = "1"
+		}
+		cleanup, err = dcgm.Init(dcgm.Standalone, *dcgmAddress, isSocket)
+	default:
+		cleanup, err = dcgm.Init(dcgm.Embedded)
+	}
+	if err != nil {
+		countDCGMError("init", err)
+		dcgmSession.initFailures++
+		dcgmSession.retryAt = time.Now().Add(dcgmInitBackoff(dcgmSession.initFailures))
+		return fmt.Errorf("dcgm init: %w (%s)", errDCGMUnavailable, err)
+	}
+	dcgmSession.cleanup = cleanup
+	dcgmSession.initFailures = 0
+	dcgmSession.retryAt = time.Time{}
+	return nil
+}
+
+// dcgmInitBackoff returns how long to wait after the given number of
+// consecutive failed initializations.
+func dcgmInitBackoff(failures int) time.Duration {
+	backoff := dcgmInitMinBackoff
+	for i := 1; i < failures && backoff < dcgmInitMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, dcgmInitMaxBackoff)
+}
+
+// dcgmListed records whether listing the GPUs succeeded. DCGM doesn't recover
+// from a crashed host engine or a dropped connection on its own, so after
+// --collector.dcgm.restart-after failures in a row the engine is shut down,
+// and the next dcgmInit starts it afresh.
+func dcgmListed(logger *slog.Logger, err error) {
+	dcgmSession.mtx.Lock()
+	defer dcgmSession.mtx.Unlock()
+
+	if err == nil {
+		dcgmSession.listFailures = 0
+		return
+	}
+	dcgmSession.listFailures++
+	if *dcgmRestartAfter <= 0 || dcgmSession.listFailures < *dcgmRestartAfter || dcgmSession.cleanup == nil {
+		return
+	}
+	logger.Warn("restarting DCGM after consecutive failures", "mode", *dcgmMode, "failures", dcgmSession.listFailures, "err", err)
+	dropDCGMWatches(logger)
+	dcgmSession.cleanup()
+	dcgmSession.cleanup = nil
+	dcgmSession.listFailures = 0
+	dcgmRestarts.Inc()
+	if *dcgmMode == "embedded" {
+		// The groups went away with the engine.
+		dcgmFieldGroups.Set(0)
+		dcgmWatchGroups.Set(0)
+	}
+}
+
+// InitDCGM sets up DCGM ahead of the first scrape.
+// Failures are only logged, as collectors retry on every scrape and some
+// collectors don't need DCGM at all.
+func InitDCGM(logger *slog.Logger) {
+	if err := dcgmInit(); err != nil {
+		logger.Warn("DCGM unavailable, retrying on scrape", "err", err)
+	}
+}
+
+// ShutdownDCGM stops the embedded DCGM host engine or disconnects from the
+// standalone one.
+func ShutdownDCGM() {
+	dcgmSession.mtx.Lock()
+	defer dcgmSession.mtx.Unlock()
+
+	if dcgmSession.cleanup != nil {
+		dropDCGMWatches(slog.New(slog.DiscardHandler))
+		dcgmSession.cleanup()
+		dcgmSession.cleanup = nil
+	}
+}
+
+// dcgmGPU is a GPU reported by DCGM together with the latest values of the
+// fields a collector asked for.
+type dcgmGPU struct {
+	id uint
+	// index is the NVML index of the GPU, exported as gpu_id so that the
+	// metrics of DCGM and NVML collectors match.
+	index  int
+	info   dcgm.Device
+	values map[dcgm.Short]dcgm.FieldValue_v1
+	// labels holds the hostname, gpu_id and gpu_name label values.
+	labels []string
+}
+
+// collectDCGMGPUs calls fn for every supported GPU with
+// the current values of fields. GPUs whose device info or field values can't
+// be read are logged and skipped, so one broken GPU doesn't hide the others.
+func collectDCGMGPUs(logger *slog.Logger, fields []dcgm.Short, fn func(gpu dcgmGPU)) error {
+	hostname := nodeName
+	// The DCGM slot is released before fn runs.
+	release := lockDCGM()
+	gpus, err := gpuBackend.dcgmGPUs(logger, fields)
+	release()
+	if err != nil {
+		return err
+	}
+	for _, gpu := range gpus {
+		gpu.labels = dcgmLabels(hostname, gpu)
+		fn(gpu)
+	}
+	return nil
+}
+
+// dcgmLabelCache holds the label values of the GPUs DCGM reported so far by
+// NVML index, shared by all collectors.
+var dcgmLabelCache struct {
+	mtx    sync.Mutex
+	labels map[int][]string
+}
+
+// dcgmLabels returns the label values of gpu, building them again only when
+// its name changed.
+func dcgmLabels(hostname string, gpu dcgmGPU) []string {
+	name := gpuDisplayName(gpu.info)
+	dcgmLabelCache.mtx.Lock()
+	defer dcgmLabelCache.mtx.Unlock()
+	if labels, ok := dcgmLabelCache.labels[gpu.index]; ok && labels[0] == hostname && labels[2] == name {
+		return labels
+	}
+	if dcgmLabelCache.labels == nil {
+		dcgmLabelCache.labels = make(map[int][]string)
+	}
+	labels := []string{hostname, strconv.Itoa(gpu.index), name}
+	dcgmLabelCache.labels[gpu.index] = labels
+	return labels
+}
+
+func (libraryBackend) dcgmGPUs(logger *slog.Logger, fields []dcgm.Short) ([]dcgmGPU, error) {
+	if err := dcgmInit(); err != nil {
+		return nil, err
+	}
+
+	gpuIDs, err := dcgm.GetSupportedDevices()
+	dcgmListed(logger, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list supported GPUs: %w", countDCGMError("get_supported_devices", err))
+	}
+	markEnumerated()
+	if len(gpuIDs) == 0 {
+		logger.Warn("DCGM did not report any GPUs on this node")
+		return nil, nil
+	}
+
+	indexes := dcgmNVMLIndexes(gpuIDs, logger)
+
+	// Device info is read first, so GPUs whose info can't be read are
+	// left out of the group.
+	infos := make([]*dcgm.Device, len(gpuIDs))
+	forEachGPU(len(gpuIDs), func(i int) {
+		index := indexes[gpuIDs[i]]
+		deviceInfo, err := dcgm.GetDeviceInfo(gpuIDs[i])
+		if err != nil {
+			if gpuSelected(index, "") {
+				logger.Warn("failed to query DCGM device info", "gpu_id", gpuIDs[i], "err", countDCGMError("get_device_info", err))
+				markDeviceFailed(strconv.Itoa(index))
+			}
+			return
+		}
+		if !gpuSelected(index, deviceInfo.UUID) {
+			return
+		}
+		markDeviceSeen(strconv.Itoa(index))
+		infos[i] = &deviceInfo
+	})
+	gpus := make([]dcgmGPU, 0, len(gpuIDs))
+	ids := make([]uint, 0, len(gpuIDs))
+	for i, info := range infos {
+		if info == nil {
+			continue
+		}
+		gpus = append(gpus, dcgmGPU{id: gpuIDs[i], index: indexes[gpuIDs[i]], info: *info})
+		ids = append(ids, gpuIDs[i])
+	}
+	if len(gpus) == 0 {
+		return nil, nil
+	}
+
+	fieldValues, err := collectGroupFieldValues(ids, fields, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect DCGM field values: %w", err)
+	}
+	for i := range gpus {
+		gpus[i].values = fieldValues[gpus[i].id]
+	}
+	return gpus, nil
+}
+
+// dcgmNVMLIndexes returns the NVML index of each of gpuIDs. DCGM numbers GPUs
+// on its own, which doesn't always match NVML, e.g. when a standalone host
+// engine started before a GPU was added. GPUs whose index DCGM can't report
+// keep their DCGM GPU ID.
+func dcgmNVMLIndexes(gpuIDs []uint, logger *slog.Logger) map[uint]int {
+	indexes := make(map[uint]int, len(gpuIDs))
+	for _, gpuID := range gpuIDs {
+		indexes[gpuID] = int(gpuID)
+	}
+	values, err := collectGroupFieldValues(gpuIDs, []dcgm.Short{dcgm.DCGM_FI_DEV_NVML_INDEX}, logger)
+	if err != nil {
+		logger.Debug("failed to read nvml indexes from DCGM", "err", err)
+		return indexes
+	}
+	for gpuID, fields := range values {
+		if value, ok := fields[dcgm.DCGM_FI_DEV_NVML_INDEX]; ok && value.FieldType == dcgm.DCGM_FT_INT64 {
+			indexes[gpuID] = int(value.Int64())
+		}
+	}
+	return indexes
+}
+
+// collectGroupFieldValues returns the latest values of fields for all of
+// gpuIDs, indexed by GPU. The GPUs are watched as one DCGM group and read
+// with a single call, which is much cheaper than a watch and a read per GPU
+// on nodes with 8 or more GPUs. Fields that are unsupported or carry one of
+// DCGM's blank sentinel values are left out of the result.
+func collectGroupFieldValues(gpuIDs []uint, fields []dcgm.Short, logger *slog.Logger) (map[uint]map[dcgm.Short]dcgm.FieldValue_v1, error) {
+	entities := make([]dcgm.GroupEntityPair, 0, len(gpuIDs))
+	for _, gpuID := range gpuIDs {
+		entities = append(entities, dcgm.GroupEntityPair{EntityGroupId: dcgm.FE_GPU, EntityId: gpuID})
+	}
+	if err := watchDCGMFields(fmt.Sprintf("gpus %v", fields), entities, fields, logger); err != nil {
+		return nil, err
+	}
+
+	values, err := dcgm.EntitiesGetLatestValues(entities, fields, 0)
+	if err != nil {
+		return nil, fmt.Errorf("get latest values: %w", countDCGMError("get_latest_values", err))
+	}
+
+	byGPU := make(map[uint][]dcgm.FieldValue_v1, len(gpuIDs))
+	for _, value := range values {
+		byGPU[value.EntityID] = append(byGPU[value.EntityID], dcgm.FieldValue_v1{
+			Version:   value.Version,
+			FieldID:   value.FieldID,
+			FieldType: value.FieldType,
+			Status:    value.Status,
+			TS:        value.TS,
+			Value:     value.Value,
+		})
+	}
+	result := make(map[uint]map[dcgm.Short]dcgm.FieldValue_v1, len(gpuIDs))
+	for _, gpuID := range gpuIDs {
+		result[gpuID] = validFieldValues(byGPU[gpuID])
+	}
+	return result, nil
+}
+
+// collectEntityFieldValues returns the latest values of fields for a single
+// entity other than a physical GPU, such as a MIG GPU instance. Fields that
+// are unsupported or blank are left out.
+func collectEntityFieldValues(entityGroup dcgm.Field_Entity_Group, entityID uint, fields []dcgm.Short, logger *slog.Logger) (map[dcgm.Short]dcgm.FieldValue_v1, error) {
+	entities := []dcgm.GroupEntityPair{{EntityGroupId: entityGroup, EntityId: entityID}}
+	if err := watchDCGMFields(fmt.Sprintf("entity %d/%d %v", entityGroup, entityID, fields), entities, fields, logger); err != nil {
+		return nil, err
+	}
+
+	values, err := dcgm.EntityGetLatestValues(entityGroup, entityID, fields)
+	if err != nil {
+		return nil, fmt.Errorf("get latest values: %w", countDCGMError("get_latest_values", err))
+	}
+
+	return validFieldValues(values), nil
+}
+
+// dcgmWatch is a field group DCGM watches on a group of entities.
+type dcgmWatch struct {
+	fieldsGroup dcgm.FieldHandle
+	group       dcgm.GroupHandle
+	// entities identifies the watched entities, so that the watch is
+	// replaced when GPUs come and go.
+	entities string
+}
+
+// dcgmWatches holds the watches of the current DCGM session by the fields and
+// entities they cover. Fields are watched once per session, so DCGM samples
+// them in the background as configured by --collector.dcgm.update-frequency,
+// --collector.dcgm.max-keep-age and --collector.dcgm.max-keep-samples, and
+// collections only read the latest samples.
+var dcgmWatches struct {
+	mtx     sync.Mutex
+	watches map[string]*dcgmWatch
+}
+
+// watchDCGMFields makes DCGM watch fields on entities under key, unless the
+// current session does already.
+func watchDCGMFields(key string, entities []dcgm.GroupEntityPair, fields []dcgm.Short, logger *slog.Logger) error {
+	watched := fmt.Sprint(entities)
+	dcgmWatches.mtx.Lock()
+	defer dcgmWatches.mtx.Unlock()
+
+	if w, ok := dcgmWatches.watches[key]; ok {
+		if w.entities == watched {
+			return nil
+		}
+		w.destroy(logger)
+		delete(dcgmWatches.watches, key)
+	}
+
+	suffix := time.Now().UnixNano()
+	fieldsGroup, err := dcgm.FieldGroupCreate(fmt.Sprintf("gpu-exporter-fields-%d", suffix), fields)
+	if err != nil {
+		return fmt.Errorf("create field group: %w", countDCGMError("field_group_create", err))
+	}
+	dcgmFieldGroups.Inc()
+	group, err := dcgm.CreateGroup(fmt.Sprintf("gpu-exporter-watch-%d", suffix))
+	if err != nil {
+		destroyFieldGroup(fieldsGroup, logger)
+		return fmt.Errorf("create group: %w", countDCGMError("create_group", err))
+	}
+	dcgmWatchGroups.Inc()
+	w := &dcgmWatch{fieldsGroup: fieldsGroup, group: group, entities: watched}
+
+	for _, entity := range entities {
+		if err := dcgm.AddEntityToGroup(group, entity.EntityGroupId, entity.EntityId); err != nil {
+			w.destroy(logger)
+			return fmt.Errorf("add entity %d to group: %w", entity.EntityId, countDCGMError("add_to_group", err))
+		}
+	}
+	// Watching also has DCGM sample the fields once, so they can be read
+	// right away.
+	if err := watchFields(fieldsGroup, group); err != nil {
+		w.destroy(logger)
+		return fmt.Errorf("watch fields: %w", countDCGMError("watch_fields", err))
+	}
+
+	if dcgmWatches.watches == nil {
+		dcgmWatches.watches = make(map[string]*dcgmWatch)
+	}
+	dcgmWatches.watches[key] = w
+	return nil
+}
+
+// dropDCGMWatches destroys the watches of the session that is ending.
+func dropDCGMWatches(logger *slog.Logger) {
+	dcgmWatches.mtx.Lock()
+	defer dcgmWatches.mtx.Unlock()
+
+	for _, w := range dcgmWatches.watches {
+		w.destroy(logger)
+	}
+	dcgmWatches.watches = nil
+}
+
+// destroy destroys the groups of w, which stops DCGM watching the fields
+// once no other group watches them.
+func (w *dcgmWatch) destroy(logger *slog.Logger) {
+	if err := dcgm.DestroyGroup(w.group); err != nil {
+		logger.Debug("failed to destroy DCGM group", "err", err)
+	} else {
+		dcgmWatchGroups.Dec()
+	}
+	destroyFieldGroup(w.fieldsGroup, logger)
+}
+
+func destroyFieldGroup(fieldsGroup dcgm.FieldHandle, logger *slog.Logger) {
+	if err := dcgm.FieldGroupDestroy(fieldsGroup); err != nil {
+		logger.Debug("failed to destroy DCGM field group", "err", err)
+		return
+	}
+	dcgmFieldGroups.Dec()
+}
+
+// watchFields makes DCGM sample the fields of fieldsGroup on the entities of
+// group with the configured watch parameters.
+func watchFields(fieldsGroup dcgm.FieldHandle, group dcgm.GroupHandle) error {
+	return dcgm.WatchFieldsWithGroupEx(
+		fieldsGroup,
+		group,
+		dcgmUpdateFrequency.Microseconds(),
+		dcgmMaxKeepAge.Seconds(),
+		*dcgmMaxKeepSamples,
+	)
+}
+
+// validFieldValues indexes values by field, dropping unsupported and blank
+// values.
+func validFieldValues(values []dcgm.FieldValue_v1) map[dcgm.Short]dcgm.FieldValue_v1 {
+	result := make(map[dcgm.Short]dcgm.FieldValue_v1, len(values))
+	for _, value := range values {
+		if value.Status != dcgm.DCGM_ST_OK || isBlankFieldValue(value) {
+			continue
+		}
+		result[value.FieldID] = value
+	}
+	return result
+}
+
+// withFieldTimestamp attaches the sample time of value to m when
+// --collector.dcgm.timestamps is set.
+func withFieldTimestamp(m prometheus.Metric, value dcgm.FieldValue_v1) prometheus.Metric {
+	if !*dcgmTimestamps || value.TS <= 0 {
+		return m
+	}
+	return prometheus.NewMetricWithTimestamp(time.UnixMicro(value.TS), m)
+}
+
+// isBlankFieldValue reports whether value holds one of DCGM's sentinel values
+// for missing, unsupported or unpermitted data.
+func isBlankFieldValue(value dcgm.FieldValue_v1) bool {
+	switch value.FieldType {
+	case dcgm.DCGM_FT_INT64:
+		return dcgm.IsInt64Blank(value.Int64())
+	case dcgm.DCGM_FT_DOUBLE:
+		return value.Float64() >= dcgm.DCGM_FT_FP64_BLANK
+	case dcgm.DCGM_FT_STRING:
+		return value.String() == dcgm.DCGM_FT_STR_BLANK
+	}
+	return false
+}
+
+func gpuDisplayName(info dcgm.Device) string {
+	if info.Identifiers.Model != "" {
+		return info.Identifiers.Model
+	}
+	if info.Identifiers.Brand != "" {
+		return info.Identifiers.Brand
+	}
+	return fmt.Sprintf("gpu-%d", info.GPU)
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	DCGMFieldsSubsystem = "dcgm"
+)
+
+var dcgmFieldsConfig = kingpin.Flag(
+	"collector.dcgm_fields.config",
+	"Path to a CSV file of extra DCGM fields to export, one per line as <field>,<metric name>,<gauge|counter>,<help>. <field> is a DCGM field name such as DCGM_FI_DEV_SM_CLOCK or its numeric ID, and the metric is exported as gpu_dcgm_<metric name>. Lines starting with # are ignored.",
+).String()
+
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// dcgmFieldMetric is a DCGM field exported as configured by the user.
+type dcgmFieldMetric struct {
+	field dcgm.Short
+	desc  typedDesc
+}
+
+// dcgmFieldsCollector exports the DCGM fields listed in
+// --collector.dcgm_fields.config, so fields the other collectors don't cover
+// can be exported without changing the exporter. The list is read again on
+// reload.
+type dcgmFieldsCollector struct {
+	logger *slog.Logger
+
+	mtx     sync.Mutex
+	metrics []dcgmFieldMetric
+	fields  []dcgm.Short
+}
+
+func init() {
+	registerCollector("dcgm_fields", NewDCGMFieldsCollector)
+}
+
+func NewDCGMFieldsCollector(logger *slog.Logger) (Collector, error) {
+	c := &dcgmFieldsCollector{logger: logger}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads --collector.dcgm_fields.config again. The previous list is
+// kept if the file is invalid.
+func (c *dcgmFieldsCollector) reload() error {
+	if *dcgmFieldsConfig == "" {
+		return nil
+	}
+	metrics, err := readDCGMFieldsConfig(*dcgmFieldsConfig)
+	if err != nil {
+		return err
+	}
+	fields := make([]dcgm.Short, 0, len(metrics))
+	for _, metric := range metrics {
+		fields = append(fields, metric.field)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.metrics, c.fields = metrics, fields
+	c.logger.Debug("loaded dcgm fields config", "path", *dcgmFieldsConfig, "fields", len(metrics))
+	return nil
+}
+
+// readDCGMFieldsConfig reads and parses the file at path.
+func readDCGMFieldsConfig(path string) ([]dcgmFieldMetric, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("dcgm fields config: %w", err)
+	}
+	defer f.Close()
+	metrics, err := parseDCGMFieldsConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("dcgm fields config %s: %w", path, err)
+	}
+	return metrics, nil
+}
+
+// parseDCGMFieldsConfig parses the format of --collector.dcgm_fields.config.
+func parseDCGMFieldsConfig(r io.Reader) ([]dcgmFieldMetric, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var metrics []dcgmFieldMetric
+	names := make(map[string]bool)
+	fields := make(map[dcgm.Short]bool)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 4 {
+			return nil, fmt.Errorf("line %d: expected 4 columns, got %d", line, len(record))
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+
+		field, err := parseDCGMField(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if fields[field] {
+			return nil, fmt.Errorf("line %d: field %s is listed twice", line, record[0])
+		}
+		fields[field] = true
+
+		name := record[1]
+		if !metricNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid metric name %q", line, name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("line %d: metric name %q is used twice", line, name)
+		}
+		names[name] = true
+
+		var valueType prometheus.ValueType
+		switch record[2] {
+		case "gauge":
+			valueType = prometheus.GaugeValue
+		case "counter":
+			valueType = prometheus.CounterValue
+		default:
+			return nil, fmt.Errorf("line %d: metric type must be gauge or counter, got %q", line, record[2])
+		}
+
+		metrics = append(metrics, dcgmFieldMetric{
+			field: field,
+			desc: typedDesc{newDesc(
+				prometheus.BuildFQName(namespace, DCGMFieldsSubsystem, name),
+				// Commas in the help string needn't be quoted.
+				strings.Join(record[3:], ","),
+				[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+			), valueType},
+		})
+	}
+}
+
+// parseDCGMField returns the ID of the DCGM field given by name or ID. IDs
+// are checked against the range of DCGM's field table, as go-dcgm can't look
+// up a field by ID without connecting to DCGM.
+func parseDCGMField(s string) (dcgm.Short, error) {
+	if id, err := strconv.ParseUint(s, 10, 16); err == nil {
+		if id == uint64(dcgm.DCGM_FI_UNKNOWN) || id >= uint64(dcgm.DCGM_FI_MAX_FIELDS) {
+			return 0, fmt.Errorf("unknown DCGM field ID %d, must be between 1 and %d", id, dcgm.DCGM_FI_MAX_FIELDS-1)
+		}
+		return dcgm.Short(id), nil
+	}
+	if id, ok := dcgm.GetFieldID(s); ok {
+		return id, nil
+	}
+	return 0, fmt.Errorf("unknown DCGM field %q", s)
+}
+
+func (c *dcgmFieldsCollector) Update(ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	metrics, fields := c.metrics, c.fields
+	c.mtx.Unlock()
+	if len(metrics) == 0 {
+		return nil
+	}
+	return collectDCGMGPUs(c.logger, fields, func(gpu dcgmGPU) {
+		if idleSuppressed(gpu.info.UUID) {
+			return
+		}
+		for _, metric := range metrics {
+			val, ok := gpu.values[metric.field]
+			if !ok {
+				continue
+			}
+			var v float64
+			switch val.FieldType {
+			case dcgm.DCGM_FT_INT64:
+				v = float64(val.Int64())
+			case dcgm.DCGM_FT_DOUBLE:
+				v = val.Float64()
+			default:
+				c.logger.Debug("skipping non-numeric DCGM field", "field", metric.field, "type", val.FieldType)
+				continue
+			}
+			ch <- withFieldTimestamp(metric.desc.mustNewConstMetric(v, gpu.labels...), val)
+		}
+	})
+}
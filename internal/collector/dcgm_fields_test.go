@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseDCGMField(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		field   string
+		want    dcgm.Short
+		wantErr bool
+	}{
+		{name: "name", field: "DCGM_FI_DEV_SM_CLOCK", want: dcgm.DCGM_FI_DEV_SM_CLOCK},
+		{name: "id", field: "100", want: 100},
+		{name: "largest id", field: "1442", want: 1442},
+		{name: "unknown id", field: "0", wantErr: true},
+		{name: "id beyond the table", field: "1443", wantErr: true},
+		{name: "id beyond uint16", field: "99999", wantErr: true},
+		{name: "unknown name", field: "DCGM_FI_NOPE", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseDCGMField(tc.field)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseDCGMField(%q) error = %v, want error %t", tc.field, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("parseDCGMField(%q) = %d, want %d", tc.field, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDCGMFieldsConfig(t *testing.T) {
+	type metric struct {
+		field     dcgm.Short
+		name      string
+		valueType prometheus.ValueType
+	}
+	for _, tc := range []struct {
+		name    string
+		config  string
+		want    []metric
+		wantErr string
+	}{
+		{
+			name: "fields",
+			config: "# field,name,type,help\n" +
+				"DCGM_FI_DEV_SM_CLOCK, sm_clock, gauge, SM clock, in MHz\n" +
+				"156,energy,counter,Energy\n",
+			want: []metric{
+				{dcgm.DCGM_FI_DEV_SM_CLOCK, "gpu_dcgm_sm_clock", prometheus.GaugeValue},
+				{156, "gpu_dcgm_energy", prometheus.CounterValue},
+			},
+		},
+		{name: "empty", config: "# nothing\n"},
+		{name: "missing columns", config: "100,clock,gauge\n", wantErr: "line 1: expected 4 columns"},
+		{name: "unknown field", config: "DCGM_FI_NOPE,clock,gauge,help\n", wantErr: "line 1: unknown DCGM field"},
+		{name: "field twice", config: "100,a,gauge,help\n100,b,gauge,help\n", wantErr: "line 2: field 100 is listed twice"},
+		{name: "invalid name", config: "100,sm-clock,gauge,help\n", wantErr: "line 1: invalid metric name"},
+		{name: "name twice", config: "100,clock,gauge,help\n101,clock,gauge,help\n", wantErr: "line 2: metric name \"clock\" is used twice"},
+		{name: "invalid type", config: "100,clock,histogram,help\n", wantErr: "line 1: metric type must be gauge or counter"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics, err := parseDCGMFieldsConfig(strings.NewReader(tc.config))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("parseDCGMFieldsConfig() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDCGMFieldsConfig() error = %v", err)
+			}
+			if len(metrics) != len(tc.want) {
+				t.Fatalf("parseDCGMFieldsConfig() returned %d metrics, want %d", len(metrics), len(tc.want))
+			}
+			for i, want := range tc.want {
+				got := metrics[i]
+				if got.field != want.field || got.desc.valueType != want.valueType || !strings.Contains(got.desc.desc.String(), `fqName: "`+want.name+`"`) {
+					t.Errorf("metric %d = %d %s %v, want %d %s %v", i, got.field, got.desc.desc, got.desc.valueType, want.field, want.name, want.valueType)
+				}
+			}
+		})
+	}
+}
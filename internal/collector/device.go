@@ -0,0 +1,251 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUDeviceSubsystem = "device"
+)
+
+var computeModeNames = map[nvml.ComputeMode]string{
+	nvml.COMPUTEMODE_DEFAULT:           "default",
+	nvml.COMPUTEMODE_EXCLUSIVE_THREAD:  "exclusive_thread",
+	nvml.COMPUTEMODE_PROHIBITED:        "prohibited",
+	nvml.COMPUTEMODE_EXCLUSIVE_PROCESS: "exclusive_process",
+}
+
+var expectedGPUCount = kingpin.Flag(
+	"collector.gpu_device.expected-count",
+	"Number of GPUs the node is expected to have, exported as gpu_device_expected_count. 0 disables the metric.",
+).Default("0").Int()
+
+var architectureNames = map[nvml.DeviceArchitecture]string{
+	nvml.DEVICE_ARCH_KEPLER:    "kepler",
+	nvml.DEVICE_ARCH_MAXWELL:   "maxwell",
+	nvml.DEVICE_ARCH_PASCAL:    "pascal",
+	nvml.DEVICE_ARCH_VOLTA:     "volta",
+	nvml.DEVICE_ARCH_TURING:    "turing",
+	nvml.DEVICE_ARCH_AMPERE:    "ampere",
+	nvml.DEVICE_ARCH_ADA:       "ada",
+	nvml.DEVICE_ARCH_HOPPER:    "hopper",
+	nvml.DEVICE_ARCH_BLACKWELL: "blackwell",
+}
+
+var brandNames = map[nvml.BrandType]string{
+	nvml.BRAND_QUADRO:              "quadro",
+	nvml.BRAND_TESLA:               "tesla",
+	nvml.BRAND_NVS:                 "nvs",
+	nvml.BRAND_GRID:                "grid",
+	nvml.BRAND_GEFORCE:             "geforce",
+	nvml.BRAND_TITAN:               "titan",
+	nvml.BRAND_NVIDIA_VAPPS:        "nvidia_vapps",
+	nvml.BRAND_NVIDIA_VPC:          "nvidia_vpc",
+	nvml.BRAND_NVIDIA_VCS:          "nvidia_vcs",
+	nvml.BRAND_NVIDIA_VWS:          "nvidia_vws",
+	nvml.BRAND_NVIDIA_CLOUD_GAMING: "nvidia_cloud_gaming",
+	nvml.BRAND_QUADRO_RTX:          "quadro_rtx",
+	nvml.BRAND_NVIDIA_RTX:          "nvidia_rtx",
+	nvml.BRAND_NVIDIA:              "nvidia",
+	nvml.BRAND_GEFORCE_RTX:         "geforce_rtx",
+	nvml.BRAND_TITAN_RTX:           "titan_rtx",
+}
+
+// gpuDeviceCollector exports the operating state and configuration of each
+// GPU.
+type gpuDeviceCollector struct {
+	performanceState *prometheus.Desc
+	computeMode      *prometheus.Desc
+	persistenceMode  *prometheus.Desc
+	displayAttached  *prometheus.Desc
+	displayActive    *prometheus.Desc
+	firmwareInfo     *prometheus.Desc
+	gspEnabled       *prometheus.Desc
+	gspInfo          *prometheus.Desc
+	info             *prometheus.Desc
+	count            *prometheus.Desc
+	expectedCount    *prometheus.Desc
+	expected         int
+	logger           *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_device", NewGPUDeviceCollector)
+}
+
+func NewGPUDeviceCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuDeviceCollector{
+		performanceState: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "performance_state"),
+			"Current performance state of the GPU, from 0 (P0, maximum performance) to 15 (P15, minimum performance).",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		computeMode: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "compute_mode_info"),
+			"Compute mode of the GPU, one of default, exclusive_thread, prohibited or exclusive_process.",
+			[]string{"hostname", "gpu_id", "gpu_name", "compute_mode"}, nil,
+		),
+		persistenceMode: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "persistence_mode"),
+			"Whether persistence mode is enabled on the GPU.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		displayAttached: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "display_attached"),
+			"Whether a physical display is connected to the GPU (display mode).",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		displayActive: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "display_active"),
+			"Whether the GPU has a display initialized, with or without a physical display connected.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		firmwareInfo: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "firmware_info"),
+			"VBIOS and InfoROM versions of the GPU. Versions the GPU doesn't report are left empty.",
+			[]string{"hostname", "gpu_id", "gpu_name", "vbios_version", "inforom_image_version", "inforom_oem_version", "inforom_ecc_version"}, nil,
+		),
+		gspEnabled: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "gsp_firmware_enabled"),
+			"Whether the GPU runs the driver on the GPU System Processor (GSP) firmware.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		gspInfo: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "gsp_firmware_info"),
+			"Version of the GSP firmware in use. Only exported while GSP firmware is enabled.",
+			[]string{"hostname", "gpu_id", "gpu_name", "version"}, nil,
+		),
+		info: newDesc(
+			prometheus.BuildFQName(namespace, "", "info"),
+			"Static identity of the GPU. Join on gpu_id to add these labels to other metrics.",
+			[]string{"hostname", "gpu_id", "gpu_name", "uuid", "serial", "pci_bus_id", "architecture", "brand", "board_part_number"}, nil,
+		),
+		count: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "count"),
+			"Number of GPUs detected on the node.",
+			[]string{"hostname"}, nil,
+		),
+		expectedCount: newDesc(
+			prometheus.BuildFQName(namespace, GPUDeviceSubsystem, "expected_count"),
+			"Number of GPUs the node is configured to have.",
+			[]string{"hostname"}, nil,
+		),
+		expected: *expectedGPUCount,
+		logger:   logger,
+	}, nil
+}
+
+func (c *gpuDeviceCollector) Update(ch chan<- prometheus.Metric) error {
+	hostname := nodeName
+	if c.expected > 0 {
+		ch <- prometheus.MustNewConstMetric(c.expectedCount, prometheus.GaugeValue, float64(c.expected), hostname)
+	}
+
+	detected := 0
+	err := collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		detected++
+
+		if pstate, ret := gpu.device.GetPerformanceState(); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read performance state", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		} else if pstate != nvml.PSTATE_UNKNOWN {
+			ch <- prometheus.MustNewConstMetric(c.performanceState, prometheus.GaugeValue, float64(pstate), gpu.labels...)
+		}
+
+		if mode, ret := gpu.device.GetComputeMode(); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read compute mode", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		} else {
+			name, ok := computeModeNames[mode]
+			if !ok {
+				name = "unknown"
+			}
+			ch <- prometheus.MustNewConstMetric(c.computeMode, prometheus.GaugeValue, 1, withLabels(gpu.labels, name)...)
+		}
+
+		if mode, ret := gpu.device.GetPersistenceMode(); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read persistence mode", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.persistenceMode, prometheus.GaugeValue, boolToFloat(mode == nvml.FEATURE_ENABLED), gpu.labels...)
+		}
+
+		if mode, ret := gpu.device.GetDisplayMode(); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read display mode", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.displayAttached, prometheus.GaugeValue, boolToFloat(mode == nvml.FEATURE_ENABLED), gpu.labels...)
+		}
+
+		if active, ret := gpu.device.GetDisplayActive(); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read display active", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.displayActive, prometheus.GaugeValue, boolToFloat(active == nvml.FEATURE_ENABLED), gpu.labels...)
+		}
+
+		vbios, _ := gpu.device.GetVbiosVersion()
+		image, _ := gpu.device.GetInforomImageVersion()
+		oem, _ := gpu.device.GetInforomVersion(nvml.INFOROM_OEM)
+		ecc, _ := gpu.device.GetInforomVersion(nvml.INFOROM_ECC)
+		ch <- prometheus.MustNewConstMetric(c.firmwareInfo, prometheus.GaugeValue, 1, withLabels(gpu.labels, vbios, image, oem, ecc)...)
+
+		if enabled, _, ret := gpu.device.GetGspFirmwareMode(); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read gsp firmware mode", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.gspEnabled, prometheus.GaugeValue, boolToFloat(enabled), gpu.labels...)
+			if enabled {
+				if version, ret := gpu.device.GetGspFirmwareVersion(); ret == nvml.SUCCESS {
+					ch <- prometheus.MustNewConstMetric(c.gspInfo, prometheus.GaugeValue, 1, withLabels(gpu.labels, version)...)
+				}
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, withLabels(gpu.labels, gpuIdentity(gpu.device)...)...)
+	})
+	if err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(detected), hostname)
+	return nil
+}
+
+// gpuIdentity returns the uuid, serial, pci_bus_id, architecture, brand and
+// board_part_number label values of device. Values NVML doesn't report are
+// left empty.
+func gpuIdentity(device nvml.Device) []string {
+	uuid, _ := device.GetUUID()
+	serial, _ := device.GetSerial()
+	partNumber, _ := device.GetBoardPartNumber()
+
+	var busID string
+	if pci, ret := device.GetPciInfo(); ret == nvml.SUCCESS {
+		busID = cString(pci.BusId[:])
+	}
+
+	architecture := "unknown"
+	if arch, ret := device.GetArchitecture(); ret == nvml.SUCCESS {
+		if name, ok := architectureNames[arch]; ok {
+			architecture = name
+		}
+	}
+
+	brand := "unknown"
+	if b, ret := device.GetBrand(); ret == nvml.SUCCESS {
+		if name, ok := brandNames[b]; ok {
+			brand = name
+		}
+	}
+
+	return []string{uuid, serial, busID, architecture, brand, partNumber}
+}
+
+// cString converts a NUL terminated C string buffer to a Go string.
+func cString(b []uint8) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// DoctorCheck is the outcome of one of the environment checks of Doctor.
+type DoctorCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Doctor checks whether the environment allows collecting GPU metrics: that
+// the driver is loaded, its device nodes can be opened, and NVML and DCGM can
+// be initialized and see the GPUs. It is meant to be run once from the
+// command line and leaves NVML and DCGM initialized.
+func Doctor(logger *slog.Logger) []DoctorCheck {
+	return []DoctorCheck{
+		doctorDriver(),
+		doctorDeviceNodes(),
+		doctorNVML(logger),
+		doctorDCGM(),
+	}
+}
+
+func doctorDriver() DoctorCheck {
+	check := DoctorCheck{Name: "driver"}
+	version, err := os.ReadFile(procFilePath("driver", "nvidia", "version"))
+	if err != nil {
+		check.Detail = fmt.Sprintf("NVIDIA kernel module not loaded: %s", err)
+		return check
+	}
+	check.OK = true
+	check.Detail, _, _ = strings.Cut(string(version), "\n")
+	return check
+}
+
+func doctorDeviceNodes() DoctorCheck {
+	check := DoctorCheck{Name: "device nodes"}
+	nodes, _ := filepath.Glob("/dev/nvidia[0-9]*")
+	nodes = append([]string{"/dev/nvidiactl"}, nodes...)
+	var errs []error
+	for _, node := range nodes {
+		f, err := os.OpenFile(node, os.O_RDWR, 0)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f.Close()
+	}
+	if err := errors.Join(errs...); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d nodes can be opened", len(nodes))
+	return check
+}
+
+func doctorNVML(logger *slog.Logger) DoctorCheck {
+	check := DoctorCheck{Name: "nvml"}
+	if err := nvmlInit(logger); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	version, _ := nvml.SystemGetNVMLVersion()
+	driver, _ := nvml.SystemGetDriverVersion()
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		check.Detail = fmt.Sprintf("NVML %s, driver %s: device count: %s", version, driver, nvml.ErrorString(ret))
+		return check
+	}
+	var errs []error
+	for i := 0; i < count; i++ {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret == nvml.SUCCESS {
+			_, ret = device.GetUUID()
+		}
+		if ret != nvml.SUCCESS {
+			errs = append(errs, fmt.Errorf("gpu %d: %s", i, nvml.ErrorString(ret)))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		check.Detail = fmt.Sprintf("NVML %s, driver %s: %s", version, driver, err)
+		return check
+	}
+	check.OK = count > 0
+	check.Detail = fmt.Sprintf("NVML %s, driver %s, %d GPUs", version, driver, count)
+	return check
+}
+
+func doctorDCGM() DoctorCheck {
+	check := DoctorCheck{Name: "dcgm " + *dcgmMode}
+	if *dcgmMode == "standalone" {
+		check.Name += " " + *dcgmAddress
+	}
+	if err := dcgmInit(); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	gpuIDs, err := dcgm.GetSupportedDevices()
+	if err != nil {
+		check.Detail = fmt.Sprintf("list GPUs: %s", err)
+		return check
+	}
+	if len(gpuIDs) == 0 {
+		check.Detail = "no supported GPUs"
+		return check
+	}
+	info, err := dcgm.GetDeviceInfo(gpuIDs[0])
+	if err != nil {
+		check.Detail = fmt.Sprintf("gpu %d: %s", gpuIDs[0], err)
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("driver %s, %d supported GPUs", info.Identifiers.DriverVersion, len(gpuIDs))
+	return check
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUECCSubsystem = "ecc"
+)
+
+var (
+	eccErrorTypes = []struct {
+		name string
+		typ  nvml.MemoryErrorType
+	}{
+		{"sbe", nvml.MEMORY_ERROR_TYPE_CORRECTED},
+		{"dbe", nvml.MEMORY_ERROR_TYPE_UNCORRECTED},
+	}
+	eccLocations = []struct {
+		name     string
+		location nvml.MemoryLocation
+	}{
+		{"device_memory", nvml.MEMORY_LOCATION_DEVICE_MEMORY},
+		{"l1_cache", nvml.MEMORY_LOCATION_L1_CACHE},
+		{"l2_cache", nvml.MEMORY_LOCATION_L2_CACHE},
+		{"register_file", nvml.MEMORY_LOCATION_REGISTER_FILE},
+	}
+)
+
+// gpuECCCollector exports the ECC mode and single bit (SBE) and double bit
+// (DBE) ECC error counts per memory location.
+type gpuECCCollector struct {
+	modeEnabled        *prometheus.Desc
+	pendingModeEnabled *prometheus.Desc
+	volatileErrors     typedDesc
+	aggregateErrors    typedDesc
+	logger             *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_ecc", NewGPUECCCollector)
+}
+
+func NewGPUECCCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuECCCollector{
+		modeEnabled: newDesc(
+			prometheus.BuildFQName(namespace, GPUECCSubsystem, "mode_enabled"),
+			"Whether ECC is currently enabled on the GPU.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		pendingModeEnabled: newDesc(
+			prometheus.BuildFQName(namespace, GPUECCSubsystem, "pending_mode_enabled"),
+			"Whether ECC will be enabled after the next reboot. Differs from gpu_ecc_mode_enabled while a mode change is pending.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		volatileErrors: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, GPUECCSubsystem, "volatile_errors_total"),
+			"ECC errors since the driver was last loaded.",
+			[]string{"hostname", "gpu_id", "gpu_name", "error_type", "location"}, nil,
+		), prometheus.CounterValue},
+		aggregateErrors: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, GPUECCSubsystem, "aggregate_errors_total"),
+			"ECC errors over the lifetime of the GPU.",
+			[]string{"hostname", "gpu_id", "gpu_name", "error_type", "location"}, nil,
+		), prometheus.CounterValue},
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuECCCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if current, pending, ret := gpu.device.GetEccMode(); ret == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(c.modeEnabled, prometheus.GaugeValue, boolToFloat(current == nvml.FEATURE_ENABLED), gpu.labels...)
+			ch <- prometheus.MustNewConstMetric(c.pendingModeEnabled, prometheus.GaugeValue, boolToFloat(pending == nvml.FEATURE_ENABLED), gpu.labels...)
+		} else {
+			c.logger.Debug("failed to read ecc mode", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+		}
+
+		for _, errorType := range eccErrorTypes {
+			for _, location := range eccLocations {
+				labels := withLabels(gpu.labels, errorType.name, location.name)
+				if count, ret := gpu.device.GetMemoryErrorCounter(errorType.typ, nvml.VOLATILE_ECC, location.location); ret == nvml.SUCCESS {
+					ch <- c.volatileErrors.mustNewConstMetric(float64(count), labels...)
+				} else {
+					c.logger.Debug("failed to read volatile ecc counter", "gpu_index", gpu.index, "error_type", errorType.name, "location", location.name, "err", nvml.ErrorString(ret))
+				}
+				if count, ret := gpu.device.GetMemoryErrorCounter(errorType.typ, nvml.AGGREGATE_ECC, location.location); ret == nvml.SUCCESS {
+					ch <- c.aggregateErrors.mustNewConstMetric(float64(count), labels...)
+				} else {
+					c.logger.Debug("failed to read aggregate ecc counter", "gpu_index", gpu.index, "error_type", errorType.name, "location", location.name, "err", nvml.ErrorString(ret))
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ExporterSubsystem holds the metrics the exporter reports about itself.
+const ExporterSubsystem = "exporter"
+
+var (
+	backendCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: ExporterSubsystem,
+		Name:      "backend_call_duration_seconds",
+		Help:      "Duration of the backend queries collectors share, such as listing the GPUs with their DCGM field values or the GPU processes. The per-GPU NVML queries of individual collectors are only part of gpu_scrape_controller_duration_seconds.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"library", "call"})
+	libraryCallErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: ExporterSubsystem,
+		Name:      "library_call_errors_total",
+		Help:      "Number of DCGM and NVML calls that failed a collection, by the numeric return code of the library.",
+	}, []string{"library", "call", "code"})
+	dcgmFieldGroups = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: ExporterSubsystem,
+		Name:      "dcgm_field_groups",
+		Help:      "Number of DCGM field groups the exporter holds. Groups that failed to be destroyed stay counted.",
+	})
+	dcgmWatchGroups = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: ExporterSubsystem,
+		Name:      "dcgm_watch_groups",
+		Help:      "Number of DCGM entity groups the exporter holds to watch fields. Groups that failed to be destroyed stay counted.",
+	})
+	dcgmRestarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: ExporterSubsystem,
+		Name:      "dcgm_restarts_total",
+		Help:      "Number of times the exporter restarted the DCGM host engine, or reconnected to it, after listing the GPUs kept failing.",
+	})
+	enumerationChanges = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: ExporterSubsystem,
+		Name:      "enumeration_changes_total",
+		Help:      "Number of times the set of GPUs NVML enumerates changed, e.g. because a GPU fell off the bus or was reset.",
+	})
+	lastErrorDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "controller_last_error_timestamp_seconds"),
+		"Unix time of the last failure of a collector. The error itself is logged.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+// exporterMetrics are the self-observability metrics NvidiaGPUCollector
+// exports alongside its own.
+var exporterMetrics = []prometheus.Collector{
+	backendCallDuration,
+	libraryCallErrors,
+	dcgmFieldGroups,
+	dcgmWatchGroups,
+	dcgmRestarts,
+	enumerationChanges,
+}
+
+// observeBackendCall records the duration of a shared query of library that
+// started at begin.
+func observeBackendCall(library, call string, begin time.Time) {
+	backendCallDuration.WithLabelValues(library, call).Observe(time.Since(begin).Seconds())
+}
+
+func countNVMLError(call string, ret nvml.Return) {
+	libraryCallErrors.WithLabelValues("nvml", call, strconv.Itoa(int(ret))).Inc()
+}
+
+// countDCGMError counts err, which DCGM returned from call, and returns it.
+func countDCGMError(call string, err error) error {
+	code := "unknown"
+	var dcgmErr *dcgm.Error
+	if errors.As(err, &dcgmErr) {
+		code = strconv.Itoa(int(dcgmErr.Code))
+	}
+	libraryCallErrors.WithLabelValues("dcgm", call, code).Inc()
+	return err
+}
+
+// instrumentedBackend records the duration of the calls to a backend.
+type instrumentedBackend struct {
+	devices   deviceBackend
+	processes processBackend
+}
+
+func (b instrumentedBackend) dcgmGPUs(logger *slog.Logger, fields []dcgm.Short) ([]dcgmGPU, error) {
+	defer observeBackendCall("dcgm", "gpus", time.Now())
+	return b.devices.dcgmGPUs(logger, fields)
+}
+
+func (b instrumentedBackend) nvmlGPUs(logger *slog.Logger) ([]nvmlGPU, error) {
+	defer observeBackendCall("nvml", "gpus", time.Now())
+	return b.devices.nvmlGPUs(logger)
+}
+
+func (b instrumentedBackend) confComputeState() (nvml.ConfComputeSystemState, nvml.Return, uint32, nvml.Return) {
+	defer observeBackendCall("nvml", "conf_compute_state", time.Now())
+	return b.devices.confComputeState()
+}
+
+func (b instrumentedBackend) gpuFabricInfo(device nvml.Device) (nvml.GpuFabricInfo_v2, nvml.Return) {
+	defer observeBackendCall("nvml", "gpu_fabric_info", time.Now())
+	return b.devices.gpuFabricInfo(device)
+}
+
+func (b instrumentedBackend) gpuProcesses(logger *slog.Logger) ([]gpuProcessUsage, error) {
+	defer observeBackendCall("nvml", "processes", time.Now())
+	return b.processes.gpuProcesses(logger)
+}
+
+// lastErrors tracks the time of the last failure of every collector.
+type lastErrors struct {
+	mtx    sync.Mutex
+	errors map[string]time.Time
+}
+
+func (e *lastErrors) record(collector string) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.errors == nil {
+		e.errors = make(map[string]time.Time)
+	}
+	e.errors[collector] = time.Now()
+}
+
+func (e *lastErrors) collect(ch chan<- prometheus.Metric) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for collector, at := range e.errors {
+		ch <- prometheus.MustNewConstMetric(lastErrorDesc, prometheus.GaugeValue, float64(at.UnixNano())/1e9, collector)
+	}
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUFabricSubsystem = "fabric"
+)
+
+var gpuFabricStates = []struct {
+	state uint8
+	name  string
+}{
+	{nvml.GPU_FABRIC_STATE_NOT_STARTED, "not_started"},
+	{nvml.GPU_FABRIC_STATE_IN_PROGRESS, "in_progress"},
+	{nvml.GPU_FABRIC_STATE_COMPLETED, "completed"},
+}
+
+// gpuFabricCollector exports the NVLink fabric registration of GPUs on
+// NVSwitch systems. Registration is driven by the Fabric Manager, so a GPU
+// stuck in not_started usually means the Fabric Manager isn't running and
+// CUDA initialization will fail.
+type gpuFabricCollector struct {
+	state             *prometheus.Desc
+	registered        *prometheus.Desc
+	info              *prometheus.Desc
+	degradedBandwidth *prometheus.Desc
+	logger            *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_fabric", NewGPUFabricCollector)
+}
+
+func NewGPUFabricCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuFabricCollector{
+		state: newDesc(
+			prometheus.BuildFQName(namespace, GPUFabricSubsystem, "state"),
+			"Fabric registration state of the GPU, one series per state with value 1 for the current one.",
+			[]string{"hostname", "gpu_id", "gpu_name", "state"}, nil,
+		),
+		registered: newDesc(
+			prometheus.BuildFQName(namespace, GPUFabricSubsystem, "registered"),
+			"Whether the GPU completed fabric registration successfully.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		info: newDesc(
+			prometheus.BuildFQName(namespace, GPUFabricSubsystem, "info"),
+			"Fabric the GPU is registered with. Value is always 1.",
+			[]string{"hostname", "gpu_id", "gpu_name", "cluster_uuid", "clique_id"}, nil,
+		),
+		degradedBandwidth: newDesc(
+			prometheus.BuildFQName(namespace, GPUFabricSubsystem, "degraded_bandwidth"),
+			"Whether the GPU's fabric bandwidth is degraded.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuFabricCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		info, ret := gpuBackend.gpuFabricInfo(gpu.device)
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read gpu fabric info", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+		if info.State == nvml.GPU_FABRIC_STATE_NOT_SUPPORTED {
+			return
+		}
+
+		for _, s := range gpuFabricStates {
+			ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, boolToFloat(info.State == s.state), withLabels(gpu.labels, s.name)...)
+		}
+		if info.State != nvml.GPU_FABRIC_STATE_COMPLETED {
+			return
+		}
+
+		registered := nvml.Return(info.Status) == nvml.SUCCESS
+		ch <- prometheus.MustNewConstMetric(c.registered, prometheus.GaugeValue, boolToFloat(registered), gpu.labels...)
+		if !registered {
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1,
+			withLabels(gpu.labels, formatUUID(info.ClusterUuid), strconv.FormatUint(uint64(info.CliqueId), 10))...)
+
+		degraded := (info.HealthMask >> nvml.GPU_FABRIC_HEALTH_MASK_SHIFT_DEGRADED_BW) & nvml.GPU_FABRIC_HEALTH_MASK_WIDTH_DEGRADED_BW
+		if degraded != nvml.GPU_FABRIC_HEALTH_MASK_DEGRADED_BW_NOT_SUPPORTED {
+			ch <- prometheus.MustNewConstMetric(c.degradedBandwidth, prometheus.GaugeValue,
+				boolToFloat(degraded == nvml.GPU_FABRIC_HEALTH_MASK_DEGRADED_BW_TRUE), gpu.labels...)
+		}
+	})
+}
+
+func (libraryBackend) gpuFabricInfo(device nvml.Device) (nvml.GpuFabricInfo_v2, nvml.Return) {
+	info, ret := device.GetGpuFabricInfoV().V2()
+	if ret == nvml.ERROR_FUNCTION_NOT_FOUND || ret == nvml.ERROR_ARGUMENT_VERSION_MISMATCH {
+		// Drivers older than R550 only provide the first version.
+		var v1 nvml.GpuFabricInfo
+		v1, ret = device.GetGpuFabricInfo()
+		info = nvml.GpuFabricInfo_v2{
+			ClusterUuid: v1.ClusterUuid,
+			Status:      v1.Status,
+			CliqueId:    v1.CliqueId,
+			State:       v1.State,
+		}
+	}
+	return info, ret
+}
+
+func formatUUID(b [16]uint8) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUFBCSubsystem = "fbc"
+)
+
+// gpuFBCCollector exports Frame Buffer Capture (NvFBC) statistics of each
+// GPU, which matter on VDI and cloud gaming hosts.
+type gpuFBCCollector struct {
+	sessions   *prometheus.Desc
+	averageFPS *prometheus.Desc
+	latency    *prometheus.Desc
+	logger     *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_fbc", NewGPUFBCCollector)
+}
+
+func NewGPUFBCCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuFBCCollector{
+		sessions: newDesc(
+			prometheus.BuildFQName(namespace, GPUFBCSubsystem, "sessions"),
+			"Number of active frame buffer capture sessions.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		averageFPS: newDesc(
+			prometheus.BuildFQName(namespace, GPUFBCSubsystem, "average_fps"),
+			"Average frames per second across all frame buffer capture sessions.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		latency: newDesc(
+			prometheus.BuildFQName(namespace, GPUFBCSubsystem, "average_latency_seconds"),
+			"Average capture latency across all frame buffer capture sessions in seconds.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuFBCCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if idleSuppressed(gpu.uuid) {
+			return
+		}
+		stats, ret := gpu.device.GetFBCStats()
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read fbc stats", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(stats.SessionsCount), gpu.labels...)
+		ch <- prometheus.MustNewConstMetric(c.averageFPS, prometheus.GaugeValue, float64(stats.AverageFPS), gpu.labels...)
+		ch <- prometheus.MustNewConstMetric(c.latency, prometheus.GaugeValue, microsecondsToSeconds(int64(stats.AverageLatency)), gpu.labels...)
+	})
+}
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var (
+	gpuInclude = kingpin.Flag(
+		"collector.gpu.include",
+		"Only export metrics of this GPU, given by index or UUID. Can be repeated. All GPUs are exported if unset.",
+	).Strings()
+	gpuExclude = kingpin.Flag(
+		"collector.gpu.exclude",
+		"Don't export metrics of this GPU, given by index or UUID. Can be repeated, and applies after --collector.gpu.include.",
+	).Strings()
+)
+
+// gpuFilter holds the entries of --collector.gpu.include and
+// --collector.gpu.exclude.
+type gpuFilter struct {
+	include, exclude []string
+}
+
+// reloadedGPUFilter is the GPU filter applied by the last Reload, nil before
+// one ran.
+var reloadedGPUFilter atomic.Pointer[gpuFilter]
+
+func currentGPUFilter() gpuFilter {
+	if f := reloadedGPUFilter.Load(); f != nil {
+		return *f
+	}
+	return gpuFilter{include: *gpuInclude, exclude: *gpuExclude}
+}
+
+// gpuSelected reports whether the metrics of the GPU at index with uuid are
+// exported, according to --collector.gpu.include and --collector.gpu.exclude.
+// uuid is empty if it isn't known, in which case only the GPUs listed by index
+// match.
+func gpuSelected(index int, uuid string) bool {
+	return currentGPUFilter().selected(index, uuid)
+}
+
+func (f gpuFilter) selected(index int, uuid string) bool {
+	if len(f.include) > 0 && !gpuListed(f.include, index, uuid) {
+		return false
+	}
+	return !gpuListed(f.exclude, index, uuid)
+}
+
+func gpuListed(list []string, index int, uuid string) bool {
+	return slices.Contains(list, strconv.Itoa(index)) || (uuid != "" && slices.Contains(list, uuid))
+}
+
+// checkGPUFilter returns an error if an entry of --collector.gpu.include or
+// --collector.gpu.exclude is neither an index nor a UUID, which would never
+// match.
+func checkGPUFilter() error {
+	return gpuFilter{include: *gpuInclude, exclude: *gpuExclude}.check()
+}
+
+func (f gpuFilter) check() error {
+	for _, entry := range slices.Concat(f.include, f.exclude) {
+		if _, err := strconv.ParseUint(entry, 10, 32); err == nil {
+			continue
+		}
+		if strings.HasPrefix(entry, "GPU-") || strings.HasPrefix(entry, "MIG-") {
+			continue
+		}
+		return fmt.Errorf("gpu filter: %q is neither a GPU index nor a UUID", entry)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package collector
+
+import "testing"
+
+func TestGPUFilterSelected(t *testing.T) {
+	const uuid = "GPU-00000000-0000-0000-0000-000000000001"
+	for _, tc := range []struct {
+		name   string
+		filter gpuFilter
+		index  int
+		uuid   string
+		want   bool
+	}{
+		{name: "no filter", index: 1, uuid: uuid, want: true},
+		{name: "included by index", filter: gpuFilter{include: []string{"1"}}, index: 1, uuid: uuid, want: true},
+		{name: "included by uuid", filter: gpuFilter{include: []string{uuid}}, index: 1, uuid: uuid, want: true},
+		{name: "not included", filter: gpuFilter{include: []string{"0"}}, index: 1, uuid: uuid, want: false},
+		{name: "uuid unknown", filter: gpuFilter{include: []string{uuid}}, index: 1, want: false},
+		{name: "excluded by index", filter: gpuFilter{exclude: []string{"1"}}, index: 1, uuid: uuid, want: false},
+		{name: "excluded by uuid", filter: gpuFilter{exclude: []string{uuid}}, index: 1, uuid: uuid, want: false},
+		{name: "exclude applies after include", filter: gpuFilter{include: []string{"1"}, exclude: []string{uuid}}, index: 1, uuid: uuid, want: false},
+		{name: "other gpu excluded", filter: gpuFilter{exclude: []string{"0"}}, index: 1, uuid: uuid, want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.selected(tc.index, tc.uuid); got != tc.want {
+				t.Errorf("selected(%d, %q) = %t, want %t", tc.index, tc.uuid, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGPUFilterCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		filter  gpuFilter
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "indexes and uuids", filter: gpuFilter{include: []string{"0", "GPU-1234"}, exclude: []string{"MIG-5678"}}},
+		{name: "negative index", filter: gpuFilter{include: []string{"-1"}}, wantErr: true},
+		{name: "name", filter: gpuFilter{exclude: []string{"A100"}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.filter.check(); (err != nil) != tc.wantErr {
+				t.Errorf("check() error = %v, want error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var idleSuppressionPeriod = kingpin.Flag(
+	"collector.idle-suppression-period",
+	"Leave out the memory, utilization, clock, power, PCIe, NVLink, throttling, frame buffer capture, vGPU and custom DCGM field series of GPUs that have had no processes and 0% utilization for this long. Availability, inventory and health metrics are still exported. Idle GPUs are detected by the gpu_metrics collector. 0 disables suppression.",
+).Default("0s").Duration()
+
+// idleGPUs holds since when GPUs are idle, by UUID. The gpu_metrics collector
+// records it, and the other per-GPU collectors consult it, so they follow the
+// state of its latest collection.
+var idleGPUs struct {
+	mtx   sync.Mutex
+	since map[string]time.Time
+}
+
+// observeIdle records whether the GPU with the given UUID is idle as of now
+// and reports whether it has been idle for at least the suppression period.
+// GPUs without a known UUID are never idle.
+func observeIdle(uuid string, idle bool, now time.Time) bool {
+	idleGPUs.mtx.Lock()
+	defer idleGPUs.mtx.Unlock()
+
+	if !idle || uuid == "" || *idleSuppressionPeriod <= 0 {
+		delete(idleGPUs.since, uuid)
+		return false
+	}
+	since, ok := idleGPUs.since[uuid]
+	if !ok {
+		if idleGPUs.since == nil {
+			idleGPUs.since = make(map[string]time.Time)
+		}
+		idleGPUs.since[uuid] = now
+		return false
+	}
+	return now.Sub(since) >= *idleSuppressionPeriod
+}
+
+// idleSuppressed reports whether the series of the GPU with the given UUID
+// are left out, as it has been idle for at least the suppression period.
+func idleSuppressed(uuid string) bool {
+	idleGPUs.mtx.Lock()
+	defer idleGPUs.mtx.Unlock()
+
+	since, ok := idleGPUs.since[uuid]
+	return ok && *idleSuppressionPeriod > 0 && time.Since(since) >= *idleSuppressionPeriod
+}
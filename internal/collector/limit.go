@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+var (
+	dcgmConcurrency = kingpin.Flag(
+		"collector.dcgm.max-concurrency",
+		"Maximum number of collectors querying DCGM at the same time, 0 for no limit. The embedded host engine is not safe for concurrent field group and watch changes.",
+	).Default("1").Int()
+	nvmlConcurrency = kingpin.Flag(
+		"collector.nvml.max-concurrency",
+		"Maximum number of collectors querying NVML at the same time, 0 for no limit.",
+	).Default("0").Int()
+	gpuWorkers = kingpin.Flag(
+		"collector.gpu-workers",
+		"Maximum number of GPUs a collector queries in parallel, where its queries of different GPUs are independent. 1 queries one GPU after the other.",
+	).Default("4").Int()
+)
+
+// semaphore bounds how many goroutines hold it at the same time. A nil
+// semaphore doesn't bound anything.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// The library semaphores are created on first use, after flags are parsed.
+var (
+	dcgmSemaphore = sync.OnceValue(func() semaphore { return newSemaphore(*dcgmConcurrency) })
+	nvmlSemaphore = sync.OnceValue(func() semaphore { return newSemaphore(*nvmlConcurrency) })
+)
+
+// lockDCGM waits for a DCGM slot and returns the function releasing it.
+// Holders must not call lockDCGM again before releasing their slot.
+func lockDCGM() func() {
+	s := dcgmSemaphore()
+	s.acquire()
+	return s.release
+}
+
+// forEachGPU calls fn for every i below n, on up to --collector.gpu-workers
+// goroutines, and returns once all calls returned.
+func forEachGPU(n int, fn func(i int)) {
+	workers := min(max(*gpuWorkers, 1), n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// lockNVML waits for an NVML slot and returns the function releasing it.
+// Holders must not call lockNVML again before releasing their slot.
+func lockNVML() func() {
+	done := useNVML()
+	s := nvmlSemaphore()
+	s.acquire()
+	return func() {
+		s.release()
+		done()
+	}
+}
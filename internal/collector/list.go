@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CollectorInfo describes a registered collector for listing.
+type CollectorInfo struct {
+	Name string
+	// Enabled is whether the collector runs with the given flags, which is
+	// its default unless enabled or disabled on the command line.
+	Enabled bool
+	Metrics []MetricInfo
+	// Err is set if the collector couldn't be created, e.g. because its
+	// configuration is invalid, in which case Metrics is empty.
+	Err error
+}
+
+// MetricInfo is a metric a collector can export.
+type MetricInfo struct {
+	Name, Help string
+}
+
+// describedMetrics records the metrics newDesc describes while
+// ListCollectors creates a collector.
+var describedMetrics struct {
+	mtx       sync.Mutex
+	recording bool
+	metrics   []MetricInfo
+}
+
+// newDesc is prometheus.NewDesc, except that it records the metric for
+// ListCollectors, as a Desc doesn't expose its name and help. Collectors use
+// it for all their descriptors.
+func newDesc(fqName, help string, variableLabels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	describedMetrics.mtx.Lock()
+	if describedMetrics.recording {
+		describedMetrics.metrics = append(describedMetrics.metrics, MetricInfo{Name: fqName, Help: help})
+	}
+	describedMetrics.mtx.Unlock()
+	return prometheus.NewDesc(fqName, help, variableLabels, constLabels)
+}
+
+// ListCollectors returns all registered collectors, sorted by name, with the
+// metrics they can export. Which metrics a GPU actually exports depends on
+// what it supports. Metrics a collector only describes at collection time
+// aren't listed. The collectors are created but not started, so listing has
+// no side effects. It must not run concurrently with NewNvidiaGPUCollector.
+func ListCollectors(logger *slog.Logger) []CollectorInfo {
+	var infos []CollectorInfo
+	for name, factory := range factories {
+		info := CollectorInfo{Name: name, Enabled: *collectorState[name]}
+		describedMetrics.mtx.Lock()
+		describedMetrics.recording, describedMetrics.metrics = true, nil
+		describedMetrics.mtx.Unlock()
+
+		_, err := factory(logger.With("collector", name))
+
+		describedMetrics.mtx.Lock()
+		metrics := describedMetrics.metrics
+		describedMetrics.recording, describedMetrics.metrics = false, nil
+		describedMetrics.mtx.Unlock()
+		if err != nil {
+			info.Err = err
+		} else {
+			slices.SortFunc(metrics, func(a, b MetricInfo) int {
+				return strings.Compare(a.Name, b.Name)
+			})
+			info.Metrics = slices.CompactFunc(metrics, func(a, b MetricInfo) bool {
+				return a.Name == b.Name
+			})
+		}
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b CollectorInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return infos
+}
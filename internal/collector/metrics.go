@@ -1,13 +1,16 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
-	"os"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
@@ -17,12 +20,20 @@ const (
 	GPUMetricsSubsystem = "metrics"
 )
 
+var utilizationSamples = kingpin.Flag(
+	"collector.gpu_metrics.utilization-samples",
+	"Also export the minimum, average and maximum of the GPU utilization samples the driver took since the previous scrape, so short bursts aren't lost between scrapes.",
+).Default("false").Bool()
+
 var gpuMetricFields = []dcgm.Short{
 	dcgm.DCGM_FI_DEV_FB_FREE,
 	dcgm.DCGM_FI_DEV_FB_USED,
 	dcgm.DCGM_FI_DEV_FB_TOTAL,
 	dcgm.DCGM_FI_DEV_GPU_TEMP,
 	dcgm.DCGM_FI_DEV_GPU_UTIL,
+	dcgm.DCGM_FI_DEV_MEM_COPY_UTIL,
+	dcgm.DCGM_FI_DEV_ENC_UTIL,
+	dcgm.DCGM_FI_DEV_DEC_UTIL,
 }
 
 // GPUMetricsCollector manages Prometheus metrics for physical GPU resources and
@@ -33,9 +44,35 @@ type gpuMetricsCollector struct {
 	gpuTotalMemory *prometheus.Desc
 	gpuTemperature *prometheus.Desc
 	gpuUtilization *prometheus.Desc
+	gpuUtilMin     *prometheus.Desc
+	gpuUtilAvg     *prometheus.Desc
+	gpuUtilMax     *prometheus.Desc
+	memCopyUtil    *prometheus.Desc
+	encoderUtil    *prometheus.Desc
+	decoderUtil    *prometheus.Desc
+	jpegUtil       *prometheus.Desc
+	ofaUtil        *prometheus.Desc
+	gpuAvailable   *prometheus.Desc
 	CPUUtilization *prometheus.Desc
 	memUtilization *prometheus.Desc
 	logger         *slog.Logger
+
+	// The state kept per GPU is keyed by UUID, which DCGM and NVML agree on
+	// unlike their GPU IDs.
+	sampleUtilization bool
+	samplesMtx        sync.Mutex
+	// lastSample holds the timestamp of the newest utilization sample read
+	// per GPU.
+	lastSample map[string]uint64
+
+	// warnedFallback is set once the switch to NVML was logged.
+	warnedFallback atomic.Bool
+}
+
+// utilizationStats summarizes the utilization samples of a GPU.
+type utilizationStats struct {
+	min, max, sum float64
+	count         int
 }
 
 func init() {
@@ -44,96 +81,142 @@ func init() {
 
 func NewGPUMetricsCollector(logger *slog.Logger) (Collector, error) {
 	return &gpuMetricsCollector{
-		gpuFreeMemory: prometheus.NewDesc(
+		gpuFreeMemory: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "free_memory"),
 			"GPU free memory in bytes.",
 			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
 		),
-		gpuUsedMemory: prometheus.NewDesc(
+		gpuUsedMemory: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "used_memory"),
 			"GPU used memory in bytes.",
 			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
 		),
-		gpuTotalMemory: prometheus.NewDesc(
+		gpuTotalMemory: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "total_memory"),
 			"GPU total memory in bytes.",
 			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
 		),
-		gpuTemperature: prometheus.NewDesc(
+		gpuTemperature: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "temperature"),
 			"GPU temperature in Celsius.",
 			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
 		),
-		gpuUtilization: prometheus.NewDesc(
+		gpuUtilization: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "gpu_utilization"),
 			"GPU utilization percentage.",
 			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
 		),
-		CPUUtilization: prometheus.NewDesc(
+		gpuUtilMin: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "gpu_utilization_min"),
+			"Minimum GPU utilization percentage sampled since the previous scrape.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		gpuUtilAvg: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "gpu_utilization_avg"),
+			"Average GPU utilization percentage sampled since the previous scrape.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		gpuUtilMax: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "gpu_utilization_max"),
+			"Maximum GPU utilization percentage sampled since the previous scrape.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		memCopyUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "mem_copy_utilization"),
+			"GPU memory controller (copy engine) utilization percentage.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		encoderUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "encoder_utilization"),
+			"GPU video encoder (NVENC) utilization percentage.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		decoderUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "decoder_utilization"),
+			"GPU video decoder (NVDEC) utilization percentage.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		jpegUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "jpeg_utilization"),
+			"GPU JPEG decoder (NVJPG) utilization percentage. Only exported by GPUs with NVJPG engines.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		ofaUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "ofa_utilization"),
+			"GPU optical flow accelerator (OFA) utilization percentage. Only exported by GPUs with OFA engines.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		gpuAvailable: newDesc(
+			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "available"),
+			"Whether the GPU was reported by DCGM, or by NVML where DCGM is unavailable. Exported even while idle series are suppressed.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		CPUUtilization: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "cpu_utilization"),
 			"Node total CPU utilization percentage.",
 			[]string{"hostname"}, nil,
 		),
-		memUtilization: prometheus.NewDesc(
+		memUtilization: newDesc(
 			prometheus.BuildFQName(namespace, GPUMetricsSubsystem, "memory_utilization"),
 			"Node total memory utilization percentage.",
 			[]string{"hostname"}, nil,
 		),
 		logger: logger,
+
+		sampleUtilization: *utilizationSamples,
+		lastSample:        make(map[string]uint64),
 	}, nil
 }
 
 func (c *gpuMetricsCollector) Update(ch chan<- prometheus.Metric) error {
-	hostname := hostNameOrDefault(c.logger)
-	cleanup, err := dcgm.Init(dcgm.Embedded)
-	if err != nil {
-		return fmt.Errorf("failed to initialize DCGM: %w", err)
-	}
-	defer cleanup()
+	hostname := nodeName
+	busyGPUs := c.busyGPUs()
+	samples := c.utilizationSamples()
+	engines := c.engineUtilization()
+	now := time.Now()
 
-	gpus, err := dcgm.GetSupportedDevices()
-	if err != nil {
-		return fmt.Errorf("failed to list supported GPUs: %w", err)
-	}
-	if len(gpus) == 0 {
-		c.logger.Warn("DCGM did not report any GPUs on this node")
-		return nil
-	}
+	err := collectDCGMGPUs(c.logger, gpuMetricFields, func(gpu dcgmGPU) {
+		ch <- prometheus.MustNewConstMetric(c.gpuAvailable, prometheus.GaugeValue, 1, gpu.labels...)
 
-	for _, gpuID := range gpus {
-		deviceInfo, err := dcgm.GetDeviceInfo(gpuID)
-		if err != nil {
-			c.logger.Warn("failed to query DCGM device info", "gpu_id", gpuID, "err", err)
-			continue
+		util, hasUtil := gpu.values[dcgm.DCGM_FI_DEV_GPU_UTIL]
+		if c.idle(gpu.info.UUID, hasUtil && util.Int64() == 0, busyGPUs, now) {
+			return
 		}
 
-		fieldValues, err := c.collectFieldValues(gpuID, gpuMetricFields)
-		if err != nil {
-			c.logger.Warn("failed to collect DCGM field values", "gpu_id", gpuID, "err", err)
-			continue
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_FB_FREE]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.gpuFreeMemory, prometheus.GaugeValue, mibToBytes(val.Int64()), gpu.labels...), val)
 		}
-
-		labels := []string{
-			hostname,
-			strconv.FormatUint(uint64(gpuID), 10),
-			gpuDisplayName(deviceInfo),
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_FB_USED]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.gpuUsedMemory, prometheus.GaugeValue, mibToBytes(val.Int64()), gpu.labels...), val)
 		}
-
-		if val, ok := fieldValues[dcgm.DCGM_FI_DEV_FB_FREE]; ok {
-			ch <- prometheus.MustNewConstMetric(c.gpuFreeMemory, prometheus.GaugeValue, mibToBytes(val.Int64()), labels...)
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_FB_TOTAL]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.gpuTotalMemory, prometheus.GaugeValue, mibToBytes(val.Int64()), gpu.labels...), val)
+		}
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_GPU_TEMP]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.gpuTemperature, prometheus.GaugeValue, float64(val.Int64()), gpu.labels...), val)
+		}
+		if hasUtil {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.gpuUtilization, prometheus.GaugeValue, float64(util.Int64()), gpu.labels...), util)
 		}
-		if val, ok := fieldValues[dcgm.DCGM_FI_DEV_FB_USED]; ok {
-			ch <- prometheus.MustNewConstMetric(c.gpuUsedMemory, prometheus.GaugeValue, mibToBytes(val.Int64()), labels...)
+		c.updateSampled(ch, gpu.info.UUID, gpu.labels, engines, samples)
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_MEM_COPY_UTIL]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.memCopyUtil, prometheus.GaugeValue, float64(val.Int64()), gpu.labels...), val)
 		}
-		if val, ok := fieldValues[dcgm.DCGM_FI_DEV_FB_TOTAL]; ok {
-			ch <- prometheus.MustNewConstMetric(c.gpuTotalMemory, prometheus.GaugeValue, mibToBytes(val.Int64()), labels...)
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_ENC_UTIL]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.encoderUtil, prometheus.GaugeValue, float64(val.Int64()), gpu.labels...), val)
 		}
-		if val, ok := fieldValues[dcgm.DCGM_FI_DEV_GPU_TEMP]; ok {
-			ch <- prometheus.MustNewConstMetric(c.gpuTemperature, prometheus.GaugeValue, float64(val.Int64()), labels...)
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_DEC_UTIL]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.decoderUtil, prometheus.GaugeValue, float64(val.Int64()), gpu.labels...), val)
 		}
-		if val, ok := fieldValues[dcgm.DCGM_FI_DEV_GPU_UTIL]; ok {
-			ch <- prometheus.MustNewConstMetric(c.gpuUtilization, prometheus.GaugeValue, float64(val.Int64()), labels...)
+	})
+	if errors.Is(err, errDCGMUnavailable) {
+		if !c.warnedFallback.Swap(true) {
+			c.logger.Info("DCGM unavailable, collecting gpu metrics from NVML", "err", err)
 		}
+		err = c.updateNVML(ch, busyGPUs, engines, samples, now)
+	}
+	if err != nil {
+		return err
 	}
 
 	// Node‑level CPU / memory utilization. We treat failures here as non‑fatal
@@ -163,68 +246,171 @@ func (c *gpuMetricsCollector) Update(ch chan<- prometheus.Metric) error {
 	return nil
 }
 
-func (c *gpuMetricsCollector) collectFieldValues(gpuID uint, fields []dcgm.Short) (map[dcgm.Short]dcgm.FieldValue_v1, error) {
-	suffix := time.Now().UnixNano()
-	fieldsGroup, err := dcgm.FieldGroupCreate(fmt.Sprintf("gpu-metrics-fields-%d-%d", gpuID, suffix), fields)
-	if err != nil {
-		return nil, fmt.Errorf("create field group: %w", err)
-	}
-	defer func() {
-		if destroyErr := dcgm.FieldGroupDestroy(fieldsGroup); destroyErr != nil {
-			c.logger.Debug("failed to destroy DCGM field group", "gpu_id", gpuID, "err", destroyErr)
+// updateNVML exports the GPU metrics NVML provides as well, for nodes with
+// the driver but without DCGM.
+func (c *gpuMetricsCollector) updateNVML(ch chan<- prometheus.Metric, busyGPUs map[string]bool, engines map[string]engineUtil, samples map[string]utilizationStats, now time.Time) error {
+	return collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		ch <- prometheus.MustNewConstMetric(c.gpuAvailable, prometheus.GaugeValue, 1, gpu.labels...)
+
+		util, ret := gpu.device.GetUtilizationRates()
+		hasUtil := ret == nvml.SUCCESS
+		if c.idle(gpu.uuid, hasUtil && util.Gpu == 0, busyGPUs, now) {
+			return
 		}
-	}()
 
-	group, err := dcgm.WatchFields(gpuID, fieldsGroup, fmt.Sprintf("gpu-metrics-watch-%d-%d", gpuID, suffix))
-	if err != nil {
-		return nil, fmt.Errorf("watch fields: %w", err)
+		if memory, ret := gpu.device.GetMemoryInfo(); ret == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(c.gpuFreeMemory, prometheus.GaugeValue, float64(memory.Free), gpu.labels...)
+			ch <- prometheus.MustNewConstMetric(c.gpuUsedMemory, prometheus.GaugeValue, float64(memory.Used), gpu.labels...)
+			ch <- prometheus.MustNewConstMetric(c.gpuTotalMemory, prometheus.GaugeValue, float64(memory.Total), gpu.labels...)
+		}
+		if temp, ret := gpu.device.GetTemperature(nvml.TEMPERATURE_GPU); ret == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(c.gpuTemperature, prometheus.GaugeValue, float64(temp), gpu.labels...)
+		}
+		if hasUtil {
+			ch <- prometheus.MustNewConstMetric(c.gpuUtilization, prometheus.GaugeValue, float64(util.Gpu), gpu.labels...)
+		}
+		c.updateSampled(ch, gpu.uuid, gpu.labels, engines, samples)
+		if hasUtil {
+			ch <- prometheus.MustNewConstMetric(c.memCopyUtil, prometheus.GaugeValue, float64(util.Memory), gpu.labels...)
+		}
+		if enc, _, ret := gpu.device.GetEncoderUtilization(); ret == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(c.encoderUtil, prometheus.GaugeValue, float64(enc), gpu.labels...)
+		}
+		if dec, _, ret := gpu.device.GetDecoderUtilization(); ret == nvml.SUCCESS {
+			ch <- prometheus.MustNewConstMetric(c.decoderUtil, prometheus.GaugeValue, float64(dec), gpu.labels...)
+		}
+	})
+}
+
+// updateSampled exports the engine utilization and utilization sample
+// statistics of the GPU with the given UUID, which are read from NVML in both
+// modes.
+func (c *gpuMetricsCollector) updateSampled(ch chan<- prometheus.Metric, uuid string, labels []string, engines map[string]engineUtil, samples map[string]utilizationStats) {
+	if uuid == "" {
+		return
 	}
-	defer func() {
-		if destroyErr := dcgm.DestroyGroup(group); destroyErr != nil {
-			c.logger.Debug("failed to destroy DCGM group", "gpu_id", gpuID, "err", destroyErr)
+	if util, ok := engines[uuid]; ok {
+		if util.hasJPEG {
+			ch <- prometheus.MustNewConstMetric(c.jpegUtil, prometheus.GaugeValue, util.jpeg, labels...)
 		}
-	}()
+		if util.hasOFA {
+			ch <- prometheus.MustNewConstMetric(c.ofaUtil, prometheus.GaugeValue, util.ofa, labels...)
+		}
+	}
+	if stats, ok := samples[uuid]; ok {
+		ch <- prometheus.MustNewConstMetric(c.gpuUtilMin, prometheus.GaugeValue, stats.min, labels...)
+		ch <- prometheus.MustNewConstMetric(c.gpuUtilAvg, prometheus.GaugeValue, stats.sum/float64(stats.count), labels...)
+		ch <- prometheus.MustNewConstMetric(c.gpuUtilMax, prometheus.GaugeValue, stats.max, labels...)
+	}
+}
 
-	values, err := dcgm.GetLatestValuesForFields(gpuID, fields)
+// busyGPUs returns the UUIDs of the GPUs that currently run processes. It returns nil when
+// idle suppression is disabled or the process list is unavailable, in which
+// case no GPU is considered idle.
+func (c *gpuMetricsCollector) busyGPUs() map[string]bool {
+	if *idleSuppressionPeriod <= 0 {
+		return nil
+	}
+	usages, err := nvmlGPUProcessUsages(c.logger)
 	if err != nil {
-		return nil, fmt.Errorf("get latest values: %w", err)
+		c.logger.Debug("failed to list gpu processes for idle detection", "err", err)
+		return nil
 	}
-
-	result := make(map[dcgm.Short]dcgm.FieldValue_v1, len(values))
-	for _, value := range values {
-		if value.Status != dcgm.DCGM_ST_OK {
-			continue
-		}
-		result[value.FieldID] = value
+	busy := make(map[string]bool, len(usages))
+	for _, usage := range usages {
+		busy[usage.gpuUUID] = true
 	}
+	return busy
+}
 
-	return result, nil
+// idle records whether the GPU with the given UUID is idle in this scrape,
+// see observeIdle. GPUs are only idle without processes and at 0%
+// utilization.
+func (c *gpuMetricsCollector) idle(uuid string, zeroUtil bool, busyGPUs map[string]bool, now time.Time) bool {
+	return observeIdle(uuid, busyGPUs != nil && !busyGPUs[uuid] && zeroUtil, now)
 }
 
-func hostNameOrDefault(logger *slog.Logger) string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		if logger != nil {
-			logger.Warn("failed to determine hostname", "err", err)
+// engineUtil holds the utilization of engines DCGM doesn't report outside of
+// its profiling fields.
+type engineUtil struct {
+	jpeg, ofa       float64
+	hasJPEG, hasOFA bool
+}
+
+// engineUtilization reads the NVJPG and OFA utilization of every GPU from
+// NVML by UUID. It returns nil when NVML is unavailable.
+func (c *gpuMetricsCollector) engineUtilization() map[string]engineUtil {
+	utils := make(map[string]engineUtil)
+	err := collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		var util engineUtil
+		if v, _, ret := gpu.device.GetJpgUtilization(); ret == nvml.SUCCESS {
+			util.jpeg, util.hasJPEG = float64(v), true
+		}
+		if v, _, ret := gpu.device.GetOfaUtilization(); ret == nvml.SUCCESS {
+			util.ofa, util.hasOFA = float64(v), true
 		}
-		return "unknown"
+		if gpu.uuid != "" && (util.hasJPEG || util.hasOFA) {
+			utils[gpu.uuid] = util
+		}
+	})
+	if err != nil {
+		c.logger.Debug("failed to collect engine utilization", "err", err)
+		return nil
 	}
+	return utils
+}
 
-	if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
-		return nodeName
+// utilizationSamples summarizes the GPU utilization samples NVML took since
+// the previous scrape by UUID. It returns nil when sampling is disabled or
+// NVML is unavailable.
+func (c *gpuMetricsCollector) utilizationSamples() map[string]utilizationStats {
+	if !c.sampleUtilization {
+		return nil
 	}
+	c.samplesMtx.Lock()
+	defer c.samplesMtx.Unlock()
 
-	return hostname
-}
+	stats := make(map[string]utilizationStats)
+	err := collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		id := gpu.uuid
+		if id == "" {
+			return
+		}
+		typ, samples, ret := gpu.device.GetSamples(nvml.GPU_UTILIZATION_SAMPLES, c.lastSample[id])
+		if ret == nvml.ERROR_NOT_FOUND {
+			// No samples were taken since the previous scrape.
+			return
+		}
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read utilization samples", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
 
-func gpuDisplayName(info dcgm.Device) string {
-	if info.Identifiers.Model != "" {
-		return info.Identifiers.Model
-	}
-	if info.Identifiers.Brand != "" {
-		return info.Identifiers.Brand
+		var s utilizationStats
+		for _, sample := range samples {
+			c.lastSample[id] = max(c.lastSample[id], sample.TimeStamp)
+			v, ok := nvmlValueFloat64(typ, sample.SampleValue[:])
+			if !ok {
+				continue
+			}
+			if s.count == 0 || v < s.min {
+				s.min = v
+			}
+			if s.count == 0 || v > s.max {
+				s.max = v
+			}
+			s.sum += v
+			s.count++
+		}
+		if s.count > 0 {
+			stats[id] = s
+		}
+	})
+	if err != nil {
+		c.logger.Debug("failed to collect utilization samples", "err", err)
+		return nil
 	}
-	return fmt.Sprintf("gpu-%d", info.GPU)
+	return stats
 }
 
 func mibToBytes(value int64) float64 {
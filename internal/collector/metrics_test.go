@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// useMockBackend makes collectors created by the test report gpus mock GPUs,
+// with all flags at their defaults.
+func useMockBackend(t *testing.T, gpus int) {
+	t.Helper()
+	if _, err := kingpin.CommandLine.Parse(nil); err != nil {
+		t.Fatalf("parse default flags: %v", err)
+	}
+	devices, processes := gpuBackend, procBackend
+	t.Cleanup(func() { gpuBackend, procBackend = devices, processes })
+	UseMockBackend(gpus)
+}
+
+// updateCollector adapts a Collector for a registry to gather.
+type updateCollector struct {
+	Collector
+	t *testing.T
+}
+
+func (updateCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c updateCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := c.Update(ch); err != nil {
+		c.t.Errorf("Update() error = %v", err)
+	}
+}
+
+// gather returns the values c exports by metric name and gpu_id.
+func gather(t *testing.T, c Collector) map[string]map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(updateCollector{c, t})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	values := make(map[string]map[string]float64)
+	for _, family := range families {
+		byGPU := make(map[string]float64)
+		for _, metric := range family.GetMetric() {
+			var gpuID string
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "gpu_id" {
+					gpuID = label.GetValue()
+				}
+			}
+			byGPU[gpuID] = metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+		}
+		values[family.GetName()] = byGPU
+	}
+	return values
+}
+
+func TestGPUMetricsCollectorMock(t *testing.T) {
+	useMockBackend(t, 2)
+	c, err := NewGPUMetricsCollector(slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewGPUMetricsCollector() error = %v", err)
+	}
+	values := gather(t, c)
+
+	for _, gpuID := range []string{"0", "1"} {
+		if got := values["gpu_metrics_available"][gpuID]; got != 1 {
+			t.Errorf("gpu %s: gpu_metrics_available = %v, want 1", gpuID, got)
+		}
+		free, freeOK := values["gpu_metrics_free_memory"][gpuID]
+		used, usedOK := values["gpu_metrics_used_memory"][gpuID]
+		if !freeOK || !usedOK {
+			t.Fatalf("gpu %s: memory metrics missing: %v", gpuID, values)
+		}
+		if total := float64(mockMemoryTotalMiB << 20); free+used != total {
+			t.Errorf("gpu %s: free %v + used %v memory = %v, want %v", gpuID, free, used, free+used, total)
+		}
+		if util, ok := values["gpu_metrics_gpu_utilization"][gpuID]; !ok || util < 0 || util > 100 {
+			t.Errorf("gpu %s: gpu_metrics_gpu_utilization = %v (exported %t), want a percentage", gpuID, util, ok)
+		}
+	}
+	if _, ok := values["gpu_metrics_available"]["2"]; ok {
+		t.Errorf("gpu_metrics_available exported for gpu 2 of 2")
+	}
+}
@@ -0,0 +1,311 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	MIGSubsystem = "mig"
+)
+
+// migCollector tracks the MIG layout of every MIG capable GPU and counts
+// changes to it, so repartitioning shows up as an auditable signal. It also
+// exports memory and utilization per MIG device, since the per-GPU metrics
+// say little about the individual instances.
+type migCollector struct {
+	modeEnabled         *prometheus.Desc
+	pendingModeEnabled  *prometheus.Desc
+	reconfigurations    *prometheus.Desc
+	lastReconfiguration *prometheus.Desc
+	memoryUsed          *prometheus.Desc
+	memoryFree          *prometheus.Desc
+	memoryTotal         *prometheus.Desc
+	engineActive        *prometheus.Desc
+	logger              *slog.Logger
+
+	mtx     sync.Mutex
+	layouts map[string]*migLayoutState
+}
+
+// migDevice is a MIG device, i.e. a compute instance within a GPU instance.
+type migDevice struct {
+	device            nvml.Device
+	gpuInstanceID     int
+	computeInstanceID int
+	uuid              string
+	profile           string
+}
+
+type migLayoutState struct {
+	layout     string
+	changes    float64
+	lastChange time.Time
+}
+
+func init() {
+	registerCollector("mig", NewMIGCollector)
+}
+
+func NewMIGCollector(logger *slog.Logger) (Collector, error) {
+	return &migCollector{
+		modeEnabled: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "mode_enabled"),
+			"Whether MIG mode is currently enabled on the GPU.",
+			[]string{"hostname", "gpu_id"}, nil,
+		),
+		pendingModeEnabled: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "pending_mode_enabled"),
+			"Whether MIG mode will be enabled after the next GPU reset. Differs from gpu_mig_mode_enabled while a mode change awaits a reset.",
+			[]string{"hostname", "gpu_id"}, nil,
+		),
+		reconfigurations: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "reconfigurations_total"),
+			"Number of MIG layout changes (instances created or destroyed) observed since the exporter started.",
+			[]string{"hostname", "gpu_id"}, nil,
+		),
+		lastReconfiguration: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "last_reconfiguration_timestamp_seconds"),
+			"Unix timestamp of the last observed MIG layout change.",
+			[]string{"hostname", "gpu_id"}, nil,
+		),
+		memoryUsed: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "memory_used_bytes"),
+			"Framebuffer memory used by the MIG device in bytes.",
+			[]string{"hostname", "gpu_id", "gpu_instance_id", "compute_instance_id", "profile"}, nil,
+		),
+		memoryFree: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "memory_free_bytes"),
+			"Framebuffer memory free on the MIG device in bytes.",
+			[]string{"hostname", "gpu_id", "gpu_instance_id", "compute_instance_id", "profile"}, nil,
+		),
+		memoryTotal: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "memory_total_bytes"),
+			"Total framebuffer memory of the MIG device in bytes.",
+			[]string{"hostname", "gpu_id", "gpu_instance_id", "compute_instance_id", "profile"}, nil,
+		),
+		engineActive: newDesc(
+			prometheus.BuildFQName(namespace, MIGSubsystem, "graphics_engine_active_ratio"),
+			"Fraction of time the graphics engine of the MIG device's GPU instance was active. Requires DCGM profiling support.",
+			[]string{"hostname", "gpu_id", "gpu_instance_id", "compute_instance_id", "profile"}, nil,
+		),
+		logger:  logger,
+		layouts: make(map[string]*migLayoutState),
+	}, nil
+}
+
+func (c *migCollector) Update(ch chan<- prometheus.Metric) error {
+	hostname := nodeName
+
+	release := lockNVML()
+	defer release()
+	gpus, err := gpuBackend.nvmlGPUs(c.logger)
+	if err != nil {
+		if errors.Is(err, errNVMLUnavailable) {
+			c.logger.Debug("mig layout unavailable", "err", err)
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	var activity map[migInstanceKey]float64
+	for _, gpu := range gpus {
+		i, device := gpu.index, gpu.device
+		uuid, ret := device.GetUUID()
+		if ret != nvml.SUCCESS {
+			c.logger.Warn("failed to get gpu uuid", "gpu_index", i, "err", nvml.ErrorString(ret))
+			markDeviceFailed(strconv.Itoa(i))
+			continue
+		}
+
+		current, pending, ret := device.GetMigMode()
+		if ret == nvml.ERROR_NOT_SUPPORTED {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			c.logger.Warn("failed to get mig mode", "gpu_index", i, "err", nvml.ErrorString(ret))
+			markDeviceFailed(strconv.Itoa(i))
+			continue
+		}
+		labels := []string{hostname, strconv.Itoa(i)}
+		ch <- prometheus.MustNewConstMetric(c.modeEnabled, prometheus.GaugeValue, boolToFloat(current == nvml.DEVICE_MIG_ENABLE), labels...)
+		ch <- prometheus.MustNewConstMetric(c.pendingModeEnabled, prometheus.GaugeValue, boolToFloat(pending == nvml.DEVICE_MIG_ENABLE), labels...)
+
+		var devices []migDevice
+		if current == nvml.DEVICE_MIG_ENABLE {
+			var err error
+			devices, err = migDevices(device)
+			if err != nil {
+				c.logger.Warn("failed to read mig layout", "gpu_index", i, "err", err)
+				markDeviceFailed(strconv.Itoa(i))
+				continue
+			}
+		}
+
+		state := c.observe(uuid, migLayout(devices), now)
+		ch <- prometheus.MustNewConstMetric(c.reconfigurations, prometheus.CounterValue, state.changes, labels...)
+		if !state.lastChange.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				c.lastReconfiguration,
+				prometheus.GaugeValue,
+				float64(state.lastChange.UnixNano())/1e9,
+				labels...,
+			)
+		}
+
+		if len(devices) > 0 && activity == nil {
+			activity = c.engineActivity()
+		}
+		for _, mig := range devices {
+			migLabels := withLabels(labels,
+				strconv.Itoa(mig.gpuInstanceID),
+				strconv.Itoa(mig.computeInstanceID),
+				mig.profile,
+			)
+			if memory, ret := mig.device.GetMemoryInfo(); ret == nvml.SUCCESS {
+				ch <- prometheus.MustNewConstMetric(c.memoryUsed, prometheus.GaugeValue, float64(memory.Used), migLabels...)
+				ch <- prometheus.MustNewConstMetric(c.memoryFree, prometheus.GaugeValue, float64(memory.Free), migLabels...)
+				ch <- prometheus.MustNewConstMetric(c.memoryTotal, prometheus.GaugeValue, float64(memory.Total), migLabels...)
+			} else {
+				c.logger.Debug("failed to get mig device memory", "gpu_index", i, "mig_uuid", mig.uuid, "err", nvml.ErrorString(ret))
+			}
+			if value, ok := activity[migInstanceKey{gpu: uint(i), gpuInstance: uint(mig.gpuInstanceID)}]; ok {
+				ch <- prometheus.MustNewConstMetric(c.engineActive, prometheus.GaugeValue, value, migLabels...)
+			}
+		}
+	}
+
+	return nil
+}
+
+// migInstanceKey identifies a GPU instance by its parent's NVML index and its
+// NVML GPU instance ID.
+type migInstanceKey struct {
+	gpu         uint
+	gpuInstance uint
+}
+
+// engineActivity returns the graphics engine activity of every GPU instance
+// known to DCGM. It returns an empty map when DCGM or its profiling fields are
+// unavailable, as memory metrics are still useful without it.
+func (c *migCollector) engineActivity() map[migInstanceKey]float64 {
+	activity := make(map[migInstanceKey]float64)
+
+	release := lockDCGM()
+	defer release()
+	defer observeBackendCall("dcgm", "gpu_instance_activity", time.Now())
+	if err := dcgmInit(); err != nil {
+		c.logger.Debug("mig utilization unavailable", "err", err)
+		return activity
+	}
+
+	hierarchy, err := dcgm.GetGPUInstanceHierarchy()
+	if err != nil {
+		c.logger.Debug("failed to get mig hierarchy", "err", countDCGMError("get_gpu_instance_hierarchy", err))
+		return activity
+	}
+	for _, entry := range hierarchy.EntityList[:hierarchy.Count] {
+		if entry.Entity.EntityGroupId != dcgm.FE_GPU_I {
+			continue
+		}
+		values, err := collectEntityFieldValues(dcgm.FE_GPU_I, entry.Entity.EntityId, []dcgm.Short{dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE}, c.logger)
+		if err != nil {
+			c.logger.Debug("failed to get mig utilization", "entity_id", entry.Entity.EntityId, "err", err)
+			continue
+		}
+		if value, ok := values[dcgm.DCGM_FI_PROF_GR_ENGINE_ACTIVE]; ok {
+			activity[migInstanceKey{gpu: entry.Info.NvmlGpuIndex, gpuInstance: entry.Info.NvmlInstanceId}] = value.Float64()
+		}
+	}
+	return activity
+}
+
+// observe records the current layout of the GPU identified by uuid and
+// returns a snapshot of its state. The first observation only establishes
+// the baseline.
+func (c *migCollector) observe(uuid, layout string, now time.Time) migLayoutState {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	state, ok := c.layouts[uuid]
+	if !ok {
+		state = &migLayoutState{layout: layout}
+		c.layouts[uuid] = state
+	} else if state.layout != layout {
+		c.logger.Info("mig layout changed", "gpu_uuid", uuid, "previous", state.layout, "current", layout)
+		state.layout = layout
+		state.changes++
+		state.lastChange = now
+	}
+	return *state
+}
+
+// migDevices returns the MIG devices on device, which must have MIG mode
+// enabled.
+func migDevices(device nvml.Device) ([]migDevice, error) {
+	maxCount, ret := device.GetMaxMigDeviceCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("max mig device count: %s", nvml.ErrorString(ret))
+	}
+
+	devices := make([]migDevice, 0, maxCount)
+	for j := 0; j < maxCount; j++ {
+		handle, ret := device.GetMigDeviceHandleByIndex(j)
+		if ret == nvml.ERROR_NOT_FOUND || ret == nvml.ERROR_INVALID_ARGUMENT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("mig device handle (index=%d): %s", j, nvml.ErrorString(ret))
+		}
+		gi, _ := handle.GetGpuInstanceId()
+		ci, _ := handle.GetComputeInstanceId()
+		uuid, _ := handle.GetUUID()
+		name, _ := handle.GetName()
+		devices = append(devices, migDevice{
+			device:            handle,
+			gpuInstanceID:     gi,
+			computeInstanceID: ci,
+			uuid:              uuid,
+			profile:           migProfile(name),
+		})
+	}
+
+	return devices, nil
+}
+
+// migLayout returns a canonical description of a GPU's MIG devices. devices
+// is nil while MIG mode is disabled.
+func migLayout(devices []migDevice) string {
+	if devices == nil {
+		return ""
+	}
+	instances := make([]string, 0, len(devices))
+	for _, mig := range devices {
+		instances = append(instances, fmt.Sprintf("%d/%d/%s", mig.gpuInstanceID, mig.computeInstanceID, mig.uuid))
+	}
+	sort.Strings(instances)
+
+	return "mig:" + strings.Join(instances, ",")
+}
+
+// migProfile extracts the profile, e.g. "1g.5gb", from a MIG device name such
+// as "NVIDIA A100-SXM4-40GB MIG 1g.5gb".
+func migProfile(name string) string {
+	if i := strings.LastIndex(name, "MIG "); i >= 0 {
+		if profile := strings.TrimSpace(name[i+len("MIG "):]); profile != "" {
+			return profile
+		}
+	}
+	return "unknown"
+}
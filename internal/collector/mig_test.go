@@ -0,0 +1,47 @@
+package collector
+
+import "testing"
+
+func TestMIGProfile(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: "NVIDIA A100-SXM4-40GB MIG 1g.5gb", want: "1g.5gb"},
+		{name: "NVIDIA H100 80GB HBM3 MIG 3g.40gb ", want: "3g.40gb"},
+		{name: "NVIDIA H100 80GB HBM3 MIG 1g.10gb+me", want: "1g.10gb+me"},
+		{name: "NVIDIA A100-SXM4-40GB MIG ", want: "unknown"},
+		{name: "NVIDIA A100-SXM4-40GB", want: "unknown"},
+		{name: "", want: "unknown"},
+	} {
+		if got := migProfile(tc.name); got != tc.want {
+			t.Errorf("migProfile(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMIGLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		devices []migDevice
+		want    string
+	}{
+		{name: "mig disabled", want: ""},
+		{name: "no devices", devices: []migDevice{}, want: "mig:"},
+		{
+			name: "sorted",
+			devices: []migDevice{
+				{gpuInstanceID: 2, computeInstanceID: 0, uuid: "MIG-b"},
+				{gpuInstanceID: 1, computeInstanceID: 1, uuid: "MIG-c"},
+				{gpuInstanceID: 1, computeInstanceID: 0, uuid: "MIG-a"},
+			},
+			want: "mig:1/0/MIG-a,1/1/MIG-c,2/0/MIG-b",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := migLayout(tc.devices); got != tc.want {
+				t.Errorf("migLayout() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
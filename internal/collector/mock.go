@@ -0,0 +1,258 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/NVIDIA/go-nvml/pkg/nvml/mock"
+)
+
+const (
+	mockGPUName        = "NVIDIA A100-SXM4-80GB"
+	mockMemoryTotalMiB = 80 * 1024
+	// mockCyclePeriod is how long the synthetic utilization takes to go
+	// from idle to busy and back.
+	mockCyclePeriod = 10 * time.Minute
+)
+
+// mockBackend synthesizes GPUs, their readings and their processes without
+// any NVIDIA hardware, so dashboards, alerts and the Helm chart can be
+// developed on machines without GPUs. Utilization cycles over
+// mockCyclePeriod with every GPU out of phase, and the other readings follow
+// it. Every GPU runs one process, the exporter itself. Everything else is
+// reported as not supported.
+type mockBackend struct {
+	gpus  int
+	start time.Time
+}
+
+// UseMockBackend makes collectors report gpus synthetic GPUs instead of
+// querying DCGM and NVML. It must be called before collectors are created.
+func UseMockBackend(gpus int) {
+	backend := &mockBackend{gpus: gpus, start: time.Now()}
+	gpuBackend = instrumentedBackend{devices: backend}
+	procBackend = instrumentedBackend{processes: backend}
+}
+
+// mockReading holds the synthetic state of a GPU at a point in time.
+type mockReading struct {
+	utilization   float64 // percent
+	memoryUsedMiB float64
+	temperature   float64 // Celsius
+	power         float64 // W
+	energy        float64 // mJ since the backend started
+}
+
+func (b *mockBackend) reading(index int) mockReading {
+	elapsed := time.Since(b.start)
+	phase := 2*math.Pi*elapsed.Seconds()/mockCyclePeriod.Seconds() + float64(index)
+	utilization := math.Round(50 + 45*math.Sin(phase))
+	return mockReading{
+		utilization:   utilization,
+		memoryUsedMiB: math.Round(mockMemoryTotalMiB * (0.1 + 0.8*utilization/100)),
+		temperature:   math.Round(35 + 0.45*utilization),
+		power:         70 + 3.3*utilization,
+		// The average power over a cycle is the power at 50%.
+		energy: (70 + 3.3*50) * elapsed.Seconds() * 1000,
+	}
+}
+
+func (b *mockBackend) uuid(index int) string {
+	return fmt.Sprintf("GPU-00000000-0000-0000-0000-%012d", index)
+}
+
+func (b *mockBackend) dcgmGPUs(_ *slog.Logger, fields []dcgm.Short) ([]dcgmGPU, error) {
+	markEnumerated()
+	gpus := make([]dcgmGPU, 0, b.gpus)
+	for i := 0; i < b.gpus; i++ {
+		if !gpuSelected(i, b.uuid(i)) {
+			continue
+		}
+		markDeviceSeen(strconv.Itoa(i))
+		reading := b.reading(i)
+		values := make(map[dcgm.Short]dcgm.FieldValue_v1, len(fields))
+		for _, field := range fields {
+			if value, ok := mockFieldValue(field, reading); ok {
+				values[field] = value
+			}
+		}
+		gpus = append(gpus, dcgmGPU{
+			id:    uint(i),
+			index: i,
+			info: dcgm.Device{
+				GPU:         uint(i),
+				UUID:        b.uuid(i),
+				Identifiers: dcgm.DeviceIdentifiers{Brand: "NVIDIA", Model: mockGPUName},
+			},
+			values: values,
+		})
+	}
+	return gpus, nil
+}
+
+// mockFieldValue returns the DCGM value of field in reading. ok is false for
+// fields the mock doesn't synthesize.
+func mockFieldValue(field dcgm.Short, reading mockReading) (value dcgm.FieldValue_v1, ok bool) {
+	value = dcgm.FieldValue_v1{FieldID: field, FieldType: dcgm.DCGM_FT_INT64, Status: dcgm.DCGM_ST_OK, TS: time.Now().UnixMicro()}
+	var v float64
+	switch field {
+	case dcgm.DCGM_FI_DEV_FB_TOTAL:
+		v = mockMemoryTotalMiB
+	case dcgm.DCGM_FI_DEV_FB_USED:
+		v = reading.memoryUsedMiB
+	case dcgm.DCGM_FI_DEV_FB_FREE:
+		v = mockMemoryTotalMiB - reading.memoryUsedMiB
+	case dcgm.DCGM_FI_DEV_GPU_TEMP:
+		v = reading.temperature
+	case dcgm.DCGM_FI_DEV_GPU_UTIL:
+		v = reading.utilization
+	case dcgm.DCGM_FI_DEV_MEM_COPY_UTIL:
+		v = math.Round(reading.utilization * 0.6)
+	case dcgm.DCGM_FI_DEV_ENC_UTIL, dcgm.DCGM_FI_DEV_DEC_UTIL,
+		dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS, dcgm.DCGM_FI_DEV_UNCORRECTABLE_REMAPPED_ROWS,
+		dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING, dcgm.DCGM_FI_DEV_ROW_REMAP_FAILURE:
+		v = 0
+	case dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION:
+		v = math.Round(reading.energy)
+	case dcgm.DCGM_FI_DEV_POWER_USAGE:
+		value.FieldType = dcgm.DCGM_FT_DOUBLE
+		v = reading.power
+	case dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT, dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT,
+		dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_DEF, dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_MAX:
+		value.FieldType = dcgm.DCGM_FT_DOUBLE
+		v = 400
+	case dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_MIN:
+		value.FieldType = dcgm.DCGM_FT_DOUBLE
+		v = 100
+	default:
+		return value, false
+	}
+	if value.FieldType == dcgm.DCGM_FT_DOUBLE {
+		binary.NativeEndian.PutUint64(value.Value[:], math.Float64bits(v))
+	} else {
+		binary.NativeEndian.PutUint64(value.Value[:], uint64(int64(v)))
+	}
+	return value, true
+}
+
+// nvmlGPUs returns fresh mock devices on every call, as the mocks record
+// every call made to them.
+func (b *mockBackend) nvmlGPUs(logger *slog.Logger) ([]nvmlGPU, error) {
+	hostname := nodeName
+	markEnumerated()
+	gpus := make([]nvmlGPU, 0, b.gpus)
+	for i := 0; i < b.gpus; i++ {
+		if !gpuSelected(i, b.uuid(i)) {
+			continue
+		}
+		markDeviceSeen(strconv.Itoa(i))
+		gpus = append(gpus, nvmlGPU{
+			index:  i,
+			device: b.device(i),
+			uuid:   b.uuid(i),
+			labels: []string{hostname, strconv.Itoa(i), mockGPUName},
+		})
+	}
+	return gpus, nil
+}
+
+func (b *mockBackend) device(index int) nvml.Device {
+	reading := b.reading(index)
+	device := notSupportedDevice()
+	device.GetNameFunc = func() (string, nvml.Return) {
+		return mockGPUName, nvml.SUCCESS
+	}
+	device.GetUUIDFunc = func() (string, nvml.Return) {
+		return b.uuid(index), nvml.SUCCESS
+	}
+	device.GetIndexFunc = func() (int, nvml.Return) {
+		return index, nvml.SUCCESS
+	}
+	device.GetMemoryInfoFunc = func() (nvml.Memory, nvml.Return) {
+		total := uint64(mockMemoryTotalMiB) << 20
+		used := uint64(reading.memoryUsedMiB) << 20
+		return nvml.Memory{Total: total, Used: used, Free: total - used}, nvml.SUCCESS
+	}
+	device.GetTemperatureFunc = func(nvml.TemperatureSensors) (uint32, nvml.Return) {
+		return uint32(reading.temperature), nvml.SUCCESS
+	}
+	device.GetUtilizationRatesFunc = func() (nvml.Utilization, nvml.Return) {
+		return nvml.Utilization{Gpu: uint32(reading.utilization), Memory: uint32(reading.utilization * 0.6)}, nvml.SUCCESS
+	}
+	device.GetPowerUsageFunc = func() (uint32, nvml.Return) {
+		return uint32(reading.power * 1000), nvml.SUCCESS
+	}
+	device.GetComputeRunningProcessesFunc = func() ([]nvml.ProcessInfo, nvml.Return) {
+		return []nvml.ProcessInfo{{
+			Pid:               uint32(os.Getpid()),
+			UsedGpuMemory:     uint64(reading.memoryUsedMiB) << 20,
+			GpuInstanceId:     math.MaxUint32,
+			ComputeInstanceId: math.MaxUint32,
+		}}, nvml.SUCCESS
+	}
+	device.GetGraphicsRunningProcessesFunc = func() ([]nvml.ProcessInfo, nvml.Return) {
+		return nil, nvml.SUCCESS
+	}
+	device.GetMPSComputeRunningProcessesFunc = func() ([]nvml.ProcessInfo, nvml.Return) {
+		return nil, nvml.SUCCESS
+	}
+	return device
+}
+
+// notSupportedDevice returns a mock device on which every method fails with
+// ERROR_NOT_SUPPORTED, as the mock panics on methods without an
+// implementation.
+func notSupportedDevice() *mock.Device {
+	device := &mock.Device{}
+	v := reflect.ValueOf(device).Elem()
+	notSupported := reflect.ValueOf(nvml.ERROR_NOT_SUPPORTED)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Func || !field.CanSet() {
+			continue
+		}
+		typ := field.Type()
+		field.Set(reflect.MakeFunc(typ, func([]reflect.Value) []reflect.Value {
+			out := make([]reflect.Value, typ.NumOut())
+			for j := range out {
+				if typ.Out(j) == notSupported.Type() {
+					out[j] = notSupported
+				} else {
+					out[j] = reflect.Zero(typ.Out(j))
+				}
+			}
+			return out
+		}))
+	}
+	return device
+}
+
+func (b *mockBackend) confComputeState() (nvml.ConfComputeSystemState, nvml.Return, uint32, nvml.Return) {
+	return nvml.ConfComputeSystemState{}, nvml.ERROR_NOT_SUPPORTED, 0, nvml.ERROR_NOT_SUPPORTED
+}
+
+func (b *mockBackend) gpuFabricInfo(nvml.Device) (nvml.GpuFabricInfo_v2, nvml.Return) {
+	return nvml.GpuFabricInfo_v2{}, nvml.ERROR_NOT_SUPPORTED
+}
+
+func (b *mockBackend) gpuProcesses(logger *slog.Logger) ([]gpuProcessUsage, error) {
+	gpus, err := b.nvmlGPUs(logger)
+	if err != nil {
+		return nil, err
+	}
+	usages := make([]gpuProcessUsage, 0, len(gpus))
+	for _, gpu := range gpus {
+		if err := appendNVMLProcessUsages(&usages, gpu.device.GetComputeRunningProcesses, "compute", gpu, logger); err != nil {
+			return nil, err
+		}
+	}
+	return usages, nil
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	NVLinkSubsystem = "nvlink"
+	bytesInKiB      = 1024
+)
+
+var nvlinkStates = []string{"up", "down", "disabled"}
+
+// nvlinkCollector exports per link NVLink state and traffic of each GPU.
+type nvlinkCollector struct {
+	transmitBytes typedDesc
+	receiveBytes  typedDesc
+	linkState     *prometheus.Desc
+	logger        *slog.Logger
+}
+
+func init() {
+	registerCollector("nvlink", NewNVLinkCollector)
+}
+
+func NewNVLinkCollector(logger *slog.Logger) (Collector, error) {
+	return &nvlinkCollector{
+		transmitBytes: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, NVLinkSubsystem, "transmit_bytes_total"),
+			"Data transmitted over the NVLink link in bytes.",
+			[]string{"hostname", "gpu_id", "gpu_name", "link"}, nil,
+		), prometheus.CounterValue},
+		receiveBytes: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, NVLinkSubsystem, "receive_bytes_total"),
+			"Data received over the NVLink link in bytes.",
+			[]string{"hostname", "gpu_id", "gpu_name", "link"}, nil,
+		), prometheus.CounterValue},
+		linkState: newDesc(
+			prometheus.BuildFQName(namespace, NVLinkSubsystem, "link_state"),
+			"State of the NVLink link. Exactly one of up, down or disabled is 1.",
+			[]string{"hostname", "gpu_id", "gpu_name", "link", "state"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *nvlinkCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if idleSuppressed(gpu.uuid) {
+			return
+		}
+		states := nvlinkLinkStates(gpu.device)
+		for link, state := range states {
+			labels := withLabels(gpu.labels, strconv.Itoa(link))
+			for _, candidate := range nvlinkStates {
+				ch <- prometheus.MustNewConstMetric(c.linkState, prometheus.GaugeValue, boolToFloat(candidate == state), withLabels(labels, candidate)...)
+			}
+			if state == "disabled" {
+				continue
+			}
+
+			values := []nvml.FieldValue{
+				{FieldId: nvml.FI_DEV_NVLINK_THROUGHPUT_DATA_TX, ScopeId: uint32(link)},
+				{FieldId: nvml.FI_DEV_NVLINK_THROUGHPUT_DATA_RX, ScopeId: uint32(link)},
+			}
+			if ret := gpu.device.GetFieldValues(values); ret != nvml.SUCCESS {
+				c.logger.Debug("failed to read nvlink throughput", "gpu_index", gpu.index, "link", link, "err", nvml.ErrorString(ret))
+				continue
+			}
+			if kib, ok := nvmlFieldValueFloat64(values[0]); ok {
+				ch <- c.transmitBytes.mustNewConstMetric(kib*bytesInKiB, labels...)
+			}
+			if kib, ok := nvmlFieldValueFloat64(values[1]); ok {
+				ch <- c.receiveBytes.mustNewConstMetric(kib*bytesInKiB, labels...)
+			}
+		}
+	})
+}
+
+// nvlinkLinkStates returns the state of every NVLink link of device, indexed
+// by link. NVML doesn't report how many links a GPU has, so links that NVML
+// rejects below the highest working link are reported as disabled, while
+// the ones above it are assumed not to exist.
+func nvlinkLinkStates(device nvml.Device) []string {
+	states := make([]string, 0, nvml.NVLINK_MAX_LINKS)
+	last := -1
+	for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+		state, ret := device.GetNvLinkState(link)
+		switch {
+		case ret != nvml.SUCCESS:
+			states = append(states, "disabled")
+			continue
+		case state == nvml.FEATURE_ENABLED:
+			states = append(states, "up")
+		default:
+			states = append(states, "down")
+		}
+		last = link
+	}
+	return states[:last+1]
+}
@@ -0,0 +1,342 @@
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+var errNVMLUnavailable = errors.New("nvml unavailable")
+
+// nvmlSession keeps NVML initialized for the lifetime of the exporter, along
+// with the device handles looked up so far, so scrapes don't pay for
+// initializing NVML and collectors don't race each other's shutdown.
+var nvmlSession struct {
+	mtx         sync.Mutex
+	initialized bool
+	devices     map[int]nvml.Device
+	// labels holds the label values of the GPUs enumerated so far by
+	// index, shared by all collectors.
+	labels map[int][]string
+	// uuids are the UUIDs of the GPUs enumerated last, in index order.
+	uuids []string
+	// generation counts the resets, which invalidate all NVML handles.
+	generation int
+}
+
+// nvmlUsers is held for reading while NVML handles are in use, and for
+// writing by nvmlReset, so NVML isn't shut down under a collector.
+var nvmlUsers sync.RWMutex
+
+// nvmlResetRequest holds the logger of the pending reset, if any.
+var nvmlResetRequest atomic.Pointer[slog.Logger]
+
+// useNVML marks NVML as in use until the returned function is called, which
+// also carries out a reset requested in the meantime. Callers must not call
+// useNVML or lockNVML again before.
+func useNVML() func() {
+	nvmlUsers.RLock()
+	return func() {
+		nvmlUsers.RUnlock()
+		if nvmlResetRequest.Load() == nil {
+			return
+		}
+		nvmlUsers.Lock()
+		defer nvmlUsers.Unlock()
+		if logger := nvmlResetRequest.Swap(nil); logger != nil {
+			nvmlReset(logger)
+		}
+	}
+}
+
+// nvmlRequestReset makes NVML shut down once no one uses it anymore, so the
+// next nvmlInit initializes it afresh.
+func nvmlRequestReset(logger *slog.Logger) {
+	nvmlResetRequest.Store(logger)
+}
+
+// nvmlGeneration returns the number of resets so far, which changes whenever
+// the handles obtained before become invalid.
+func nvmlGeneration() int {
+	nvmlSession.mtx.Lock()
+	defer nvmlSession.mtx.Unlock()
+	return nvmlSession.generation
+}
+
+// nvmlInit initializes NVML unless it is initialized already. A failed
+// initialization, e.g. while the driver isn't loaded yet, is retried on the
+// next call.
+func nvmlInit(logger *slog.Logger) error {
+	nvmlSession.mtx.Lock()
+	defer nvmlSession.mtx.Unlock()
+
+	if nvmlSession.initialized {
+		return nil
+	}
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return wrapNVMLAvailabilityError("nvml init", ret)
+	}
+	logger.Debug("initialized nvml")
+	nvmlSession.initialized = true
+	nvmlSession.devices = make(map[int]nvml.Device)
+	nvmlSession.labels = make(map[int][]string)
+	return nil
+}
+
+// nvmlReset shuts NVML down, so the next nvmlInit initializes it afresh. It
+// is called after NVML lost the driver, e.g. because it was reloaded. Callers
+// hold nvmlUsers for writing; others use nvmlRequestReset.
+func nvmlReset(logger *slog.Logger) {
+	nvmlSession.mtx.Lock()
+	defer nvmlSession.mtx.Unlock()
+
+	if !nvmlSession.initialized {
+		return
+	}
+	if ret := nvml.Shutdown(); ret != nvml.SUCCESS {
+		logger.Debug("failed to shutdown nvml", "err", nvml.ErrorString(ret))
+	}
+	nvmlSession.initialized = false
+	nvmlSession.devices = nil
+	nvmlSession.labels = nil
+	nvmlSession.generation++
+}
+
+// ShutdownNVML shuts NVML down when the exporter exits, waiting for the
+// collectors still using it.
+func ShutdownNVML(logger *slog.Logger) {
+	nvmlUsers.Lock()
+	defer nvmlUsers.Unlock()
+	nvmlReset(logger)
+}
+
+// nvmlDevice returns the handle of the GPU at index, looking it up only once.
+// NVML must be initialized.
+func nvmlDevice(index int) (nvml.Device, nvml.Return) {
+	nvmlSession.mtx.Lock()
+	defer nvmlSession.mtx.Unlock()
+
+	if device, ok := nvmlSession.devices[index]; ok {
+		return device, nvml.SUCCESS
+	}
+	device, ret := nvml.DeviceGetHandleByIndex(index)
+	if ret == nvml.SUCCESS && nvmlSession.devices != nil {
+		nvmlSession.devices[index] = device
+	}
+	return device, ret
+}
+
+// nvmlLost requests a reset of NVML if ret tells it lost the driver, so a
+// later scrape initializes it again.
+func nvmlLost(logger *slog.Logger, ret nvml.Return) {
+	switch ret {
+	case nvml.ERROR_UNINITIALIZED, nvml.ERROR_DRIVER_NOT_LOADED, nvml.ERROR_GPU_IS_LOST:
+		nvmlRequestReset(logger)
+	}
+}
+
+// nvmlGPU is a GPU reported by NVML.
+type nvmlGPU struct {
+	index  int
+	device nvml.Device
+	// uuid is empty if NVML couldn't report it.
+	uuid string
+	// labels holds the hostname, gpu_id and gpu_name label values.
+	labels []string
+}
+
+// collectNVMLGPUs initializes NVML and calls fn for every GPU. GPUs whose
+// handle can't be obtained are logged and skipped. fn runs while holding an
+// NVML slot, so it must not call collectNVMLGPUs itself.
+func collectNVMLGPUs(logger *slog.Logger, fn func(gpu nvmlGPU)) error {
+	release := lockNVML()
+	defer release()
+	gpus, err := gpuBackend.nvmlGPUs(logger)
+	if err != nil {
+		return err
+	}
+	for _, gpu := range gpus {
+		fn(gpu)
+	}
+	return nil
+}
+
+// collectNVMLGPUsConcurrently is collectNVMLGPUs, except that fn runs for
+// several GPUs at the same time, see forEachGPU. fn must therefore only send
+// to channels or synchronize its own state.
+func collectNVMLGPUsConcurrently(logger *slog.Logger, fn func(gpu nvmlGPU)) error {
+	release := lockNVML()
+	defer release()
+	gpus, err := gpuBackend.nvmlGPUs(logger)
+	if err != nil {
+		return err
+	}
+	forEachGPU(len(gpus), func(i int) { fn(gpus[i]) })
+	return nil
+}
+
+func (b libraryBackend) nvmlGPUs(logger *slog.Logger) ([]nvmlGPU, error) {
+	gpus, lost, err := b.enumerateNVMLGPUs(logger)
+	if lost {
+		// A GPU fell off the bus or was reset. Its handle stays invalid
+		// and NVML only enumerates GPUs when initialized, so start over
+		// once the other collectors are done with their handles. The GPUs
+		// still there are collected meanwhile.
+		logger.Warn("lost a gpu, re-initializing nvml")
+		nvmlRequestReset(logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+	observeEnumeration(logger, gpus)
+	return gpus, nil
+}
+
+// enumerateNVMLGPUs lists the GPUs NVML reports. lost is set if a GPU
+// reported being lost, in which case it is left out.
+func (libraryBackend) enumerateNVMLGPUs(logger *slog.Logger) (gpus []nvmlGPU, lost bool, err error) {
+	hostname := nodeName
+	if err := nvmlInit(logger); err != nil {
+		return nil, false, err
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		nvmlLost(logger, ret)
+		return nil, false, wrapNVMLAvailabilityError("nvml device count", ret)
+	}
+	markEnumerated()
+
+	gpus = make([]nvmlGPU, 0, count)
+	for i := 0; i < count; i++ {
+		device, ret := nvmlDevice(i)
+		if ret != nvml.SUCCESS {
+			lost = lost || ret == nvml.ERROR_GPU_IS_LOST
+			if gpuSelected(i, "") {
+				logger.Warn("failed to get nvml device handle", "gpu_index", i, "err", nvml.ErrorString(ret))
+				markDeviceFailed(strconv.Itoa(i))
+			}
+			continue
+		}
+		uuid, ret := device.GetUUID()
+		if ret == nvml.ERROR_GPU_IS_LOST {
+			lost = true
+			logger.Warn("gpu is lost", "gpu_index", i)
+			markDeviceFailed(strconv.Itoa(i))
+			continue
+		}
+		if !gpuSelected(i, uuid) {
+			continue
+		}
+		markDeviceSeen(strconv.Itoa(i))
+		gpus = append(gpus, nvmlGPU{
+			index:  i,
+			device: device,
+			uuid:   uuid,
+			labels: nvmlLabels(hostname, i, device),
+		})
+	}
+	return gpus, lost, nil
+}
+
+// nvmlLabels returns the label values of the GPU at index, building them
+// only once. NVML must be initialized.
+func nvmlLabels(hostname string, index int, device nvml.Device) []string {
+	nvmlSession.mtx.Lock()
+	labels, ok := nvmlSession.labels[index]
+	nvmlSession.mtx.Unlock()
+	if ok {
+		return labels
+	}
+
+	name, ret := device.GetName()
+	if ret != nvml.SUCCESS || name == "" {
+		name = fmt.Sprintf("gpu-%d", index)
+	}
+	labels = []string{hostname, strconv.Itoa(index), name}
+	nvmlSession.mtx.Lock()
+	if nvmlSession.labels != nil {
+		nvmlSession.labels[index] = labels
+	}
+	nvmlSession.mtx.Unlock()
+	return labels
+}
+
+// observeEnumeration counts and logs changes of the set of GPUs since the
+// previous enumeration.
+func observeEnumeration(logger *slog.Logger, gpus []nvmlGPU) {
+	uuids := make([]string, 0, len(gpus))
+	for _, gpu := range gpus {
+		uuids = append(uuids, gpu.uuid)
+	}
+
+	nvmlSession.mtx.Lock()
+	defer nvmlSession.mtx.Unlock()
+	previous := nvmlSession.uuids
+	nvmlSession.uuids = uuids
+	if previous == nil || slices.Equal(previous, uuids) {
+		return
+	}
+	enumerationChanges.Inc()
+	logger.Warn("gpu enumeration changed", "previous", previous, "current", uuids)
+}
+
+func (libraryBackend) confComputeState() (nvml.ConfComputeSystemState, nvml.Return, uint32, nvml.Return) {
+	state, stateRet := nvml.SystemGetConfComputeState()
+	accepting, readyRet := nvml.SystemGetConfComputeGpusReadyState()
+	return state, stateRet, accepting, readyRet
+}
+
+// nvmlFieldValueFloat64 decodes an NVML field value. ok is false when NVML
+// couldn't provide the value or its type is unknown.
+func nvmlFieldValueFloat64(value nvml.FieldValue) (v float64, ok bool) {
+	if nvml.Return(value.NvmlReturn) != nvml.SUCCESS {
+		return 0, false
+	}
+	return nvmlValueFloat64(nvml.ValueType(value.ValueType), value.Value[:])
+}
+
+// nvmlValueFloat64 decodes a raw NVML value of the given type. ok is false
+// for unknown types.
+func nvmlValueFloat64(typ nvml.ValueType, raw []byte) (v float64, ok bool) {
+	switch typ {
+	case nvml.VALUE_TYPE_DOUBLE:
+		return math.Float64frombits(binary.NativeEndian.Uint64(raw)), true
+	case nvml.VALUE_TYPE_UNSIGNED_INT:
+		return float64(binary.NativeEndian.Uint32(raw)), true
+	case nvml.VALUE_TYPE_UNSIGNED_LONG, nvml.VALUE_TYPE_UNSIGNED_LONG_LONG:
+		return float64(binary.NativeEndian.Uint64(raw)), true
+	case nvml.VALUE_TYPE_SIGNED_LONG_LONG:
+		return float64(int64(binary.NativeEndian.Uint64(raw))), true
+	case nvml.VALUE_TYPE_SIGNED_INT:
+		return float64(int32(binary.NativeEndian.Uint32(raw))), true
+	case nvml.VALUE_TYPE_UNSIGNED_SHORT:
+		return float64(binary.NativeEndian.Uint16(raw)), true
+	default:
+		return 0, false
+	}
+}
+
+func wrapNVMLAvailabilityError(op string, ret nvml.Return) error {
+	countNVMLError(strings.ReplaceAll(strings.TrimPrefix(op, "nvml "), " ", "_"), ret)
+	switch ret {
+	case nvml.ERROR_UNINITIALIZED,
+		nvml.ERROR_LIBRARY_NOT_FOUND,
+		nvml.ERROR_DRIVER_NOT_LOADED,
+		nvml.ERROR_NOT_SUPPORTED,
+		nvml.ERROR_NO_PERMISSION,
+		nvml.ERROR_UNKNOWN:
+		return fmt.Errorf("%s: %w (%s)", op, errNVMLUnavailable, nvml.ErrorString(ret))
+	default:
+		return fmt.Errorf("%s: %s", op, nvml.ErrorString(ret))
+	}
+}
@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/shirou/gopsutil/v4/common"
+)
+
+// procPath is the procfs of the host PID namespace. NVML reports host PIDs,
+// so when the exporter runs in a container without hostPID, the host /proc
+// has to be mounted and passed here for them to resolve.
+var procPath = kingpin.Flag("path.procfs", "procfs mountpoint of the host PID namespace.").Default("/proc").String()
+
+func procFilePath(name ...string) string {
+	return filepath.Join(append([]string{*procPath}, name...)...)
+}
+
+// procContext returns a context that makes gopsutil read *procPath.
+func procContext() context.Context {
+	return context.WithValue(context.Background(), common.EnvKey, common.EnvMap{common.HostProcEnvKey: *procPath})
+}
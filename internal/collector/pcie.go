@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"log/slog"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUPCIeSubsystem = "pcie"
+)
+
+// gpuPCIeCollector exports PCIe link health of each GPU.
+type gpuPCIeCollector struct {
+	replays typedDesc
+	logger  *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_pcie", NewGPUPCIeCollector)
+}
+
+func NewGPUPCIeCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuPCIeCollector{
+		replays: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, GPUPCIeSubsystem, "replays_total"),
+			"Number of PCIe replays, i.e. retransmitted transactions, of the GPU.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		), prometheus.CounterValue},
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuPCIeCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if idleSuppressed(gpu.uuid) {
+			return
+		}
+		replays, ret := gpu.device.GetPcieReplayCounter()
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read pcie replay counter", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+		ch <- c.replays.mustNewConstMetric(float64(replays), gpu.labels...)
+	})
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/podresources"
+)
+
+const (
+	GPUPodSubsystem = "pod"
+)
+
+var kubeletSocket = kingpin.Flag(
+	"collector.gpu_pod.kubelet-socket",
+	"Path to the kubelet pod-resources socket used to map GPUs to the pods they are allocated to.",
+).Default(podresources.DefaultSocket).String()
+
+// gpuPodCollector exports which Kubernetes pod and container each GPU is
+// allocated to, as reported by the kubelet. Like gpu_info, the mapping is an
+// info metric to join on gpu_id, so per-GPU metrics can be broken down by
+// pod. Per-process metrics carry the namespace and pod labels themselves.
+type gpuPodCollector struct {
+	info   *prometheus.Desc
+	socket string
+	client *podresources.Client
+	logger *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_pod", NewGPUPodCollector)
+}
+
+func NewGPUPodCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuPodCollector{
+		info: newDesc(
+			prometheus.BuildFQName(namespace, GPUPodSubsystem, "info"),
+			"Pod and container a GPU, or a MIG device of it identified by uuid, is allocated to. Join on gpu_id to add these labels to other metrics.",
+			[]string{"hostname", "gpu_id", "gpu_name", "uuid", "namespace", "pod", "container"}, nil,
+		),
+		socket: *kubeletSocket,
+		client: podresources.NewClient(*kubeletSocket),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuPodCollector) Update(ch chan<- prometheus.Metric) error {
+	if _, err := os.Stat(c.socket); errors.Is(err, fs.ErrNotExist) {
+		c.logger.Debug("kubelet pod resources socket not found, not running on a Kubernetes node", "socket", c.socket)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	allocations, err := c.client.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list pod resources: %w", err)
+	}
+
+	byDevice := make(map[string][]podresources.Allocation)
+	for _, allocation := range allocations {
+		// Shared GPUs are advertised as one device per replica, e.g.
+		// GPU-<uuid>::0 with time-slicing.
+		id, _, _ := strings.Cut(allocation.DeviceID, "::")
+		byDevice[id] = append(byDevice[id], allocation)
+	}
+	if len(byDevice) == 0 {
+		return nil
+	}
+
+	return collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		uuids := gpuDeviceUUIDs(gpu.device)
+		seen := make(map[podresources.Allocation]bool)
+		for _, uuid := range uuids {
+			for _, allocation := range byDevice[uuid] {
+				// Replicas of a shared GPU may be allocated to the same
+				// container more than once.
+				key := allocation
+				key.DeviceID = uuid
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				ch <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1,
+					withLabels(gpu.labels, uuid, allocation.Namespace, allocation.Pod, allocation.Container)...)
+			}
+		}
+	})
+}
+
+// gpuDeviceUUIDs returns the UUID of device followed by the UUIDs of its MIG
+// devices, which the kubelet allocates instead of the GPU while MIG is
+// enabled.
+func gpuDeviceUUIDs(device nvml.Device) []string {
+	var uuids []string
+	if uuid, ret := device.GetUUID(); ret == nvml.SUCCESS {
+		uuids = append(uuids, uuid)
+	}
+	if current, _, ret := device.GetMigMode(); ret == nvml.SUCCESS && current == nvml.DEVICE_MIG_ENABLE {
+		devices, _ := migDevices(device)
+		for _, mig := range devices {
+			uuids = append(uuids, mig.uuid)
+		}
+	}
+	return uuids
+}
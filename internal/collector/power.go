@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"log/slog"
+	"strconv"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUPowerSubsystem = "power"
+)
+
+var gpuPowerFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_POWER_USAGE,
+	dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION,
+	dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT,
+	dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT,
+	dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_DEF,
+	dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_MIN,
+	dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_MAX,
+}
+
+var gpuPowerLimits = []struct {
+	name  string
+	field dcgm.Short
+}{
+	{"current", dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT},
+	{"enforced", dcgm.DCGM_FI_DEV_ENFORCED_POWER_LIMIT},
+	{"default", dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_DEF},
+	{"min", dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_MIN},
+	{"max", dcgm.DCGM_FI_DEV_POWER_MGMT_LIMIT_MAX},
+}
+
+// gpuPowerCollector exports the power draw, energy consumption and power
+// limits of each GPU.
+type gpuPowerCollector struct {
+	powerUsage        *prometheus.Desc
+	energyConsumption typedDesc
+	powerLimit        *prometheus.Desc
+	modulePowerUsage  *prometheus.Desc
+	logger            *slog.Logger
+}
+
+// modulePower is the power draw of the module or board a GPU sits on.
+type modulePower struct {
+	watts   float64
+	boardID string
+}
+
+func init() {
+	registerCollector("gpu_power", NewGPUPowerCollector)
+}
+
+func NewGPUPowerCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuPowerCollector{
+		powerUsage: newDesc(
+			prometheus.BuildFQName(namespace, GPUPowerSubsystem, "usage_watts"),
+			"GPU power draw in watts.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		energyConsumption: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, GPUPowerSubsystem, "energy_joules_total"),
+			"Total GPU energy consumption in joules since the driver was last reloaded.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		), prometheus.CounterValue},
+		powerLimit: newDesc(
+			prometheus.BuildFQName(namespace, GPUPowerSubsystem, "limit_watts"),
+			"GPU power management limit in watts: the configured (current) and enforced limit, the default limit and the configurable min and max.",
+			[]string{"hostname", "gpu_id", "gpu_name", "limit"}, nil,
+		),
+		modulePowerUsage: newDesc(
+			prometheus.BuildFQName(namespace, GPUPowerSubsystem, "module_usage_watts"),
+			"Power draw of the whole module or board hosting the GPU in watts. GPUs sharing a board report the same board_id and value.",
+			[]string{"hostname", "gpu_id", "gpu_name", "board_id"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuPowerCollector) Update(ch chan<- prometheus.Metric) error {
+	modules := c.modulePower()
+	return collectDCGMGPUs(c.logger, gpuPowerFields, func(gpu dcgmGPU) {
+		if idleSuppressed(gpu.info.UUID) {
+			return
+		}
+		if module, ok := modules[gpu.info.UUID]; ok {
+			ch <- prometheus.MustNewConstMetric(c.modulePowerUsage, prometheus.GaugeValue, module.watts, withLabels(gpu.labels, module.boardID)...)
+		}
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_POWER_USAGE]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.powerUsage, prometheus.GaugeValue, val.Float64(), gpu.labels...), val)
+		}
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_TOTAL_ENERGY_CONSUMPTION]; ok {
+			ch <- withFieldTimestamp(c.energyConsumption.mustNewConstMetric(float64(val.Int64())/1000, gpu.labels...), val)
+		}
+		for _, limit := range gpuPowerLimits {
+			if val, ok := gpu.values[limit.field]; ok {
+				ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.powerLimit, prometheus.GaugeValue, val.Float64(), withLabels(gpu.labels, limit.name)...), val)
+			}
+		}
+	})
+}
+
+// modulePower reads the module power draw of every GPU that reports one from
+// NVML by UUID, as NVML indexes needn't match DCGM GPU IDs. It returns nil
+// when NVML is unavailable.
+func (c *gpuPowerCollector) modulePower() map[string]modulePower {
+	modules := make(map[string]modulePower)
+	err := collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		values := []nvml.FieldValue{
+			{FieldId: nvml.FI_DEV_POWER_INSTANT, ScopeId: nvml.POWER_SCOPE_MODULE},
+		}
+		if ret := gpu.device.GetFieldValues(values); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read module power", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+		milliwatts, ok := nvmlFieldValueFloat64(values[0])
+		if !ok || gpu.uuid == "" {
+			return
+		}
+		var boardID string
+		if id, ret := gpu.device.GetBoardId(); ret == nvml.SUCCESS {
+			boardID = strconv.FormatUint(uint64(id), 10)
+		}
+		modules[gpu.uuid] = modulePower{watts: milliwatts / 1000, boardID: boardID}
+	})
+	if err != nil {
+		c.logger.Debug("failed to collect module power", "err", err)
+		return nil
+	}
+	return modules
+}
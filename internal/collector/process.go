@@ -1,28 +1,189 @@
 package collector
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shirou/gopsutil/v4/process"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/cri"
+	"github.com/V01d42/nvidia-gpu-exporter/internal/docker"
 )
 
 const (
 	GPUProcessSubsystem   = "process"
 	unknownProcessLabel   = "unknown"
 	maxCommandLabelLength = 200
+	redactedArgument      = "<redacted>"
+)
+
+var suppressZeroProcessMemory = kingpin.Flag(
+	"collector.gpu_process.suppress-zero",
+	"Don't export process series whose GPU memory usage is zero.",
+).Default("false").Bool()
+
+var aggregateProcesses = kingpin.Flag(
+	"collector.gpu_process.aggregate",
+	"Export GPU memory summed per GPU and user, or per GPU and process name, instead of per-process series, to bound cardinality on shared nodes and large fleets.",
+).Default("none").Enum("none", "user", "process_name")
+
+var processLabelFlag = kingpin.Flag(
+	"collector.gpu_process.labels",
+	"Comma-separated labels of per-process series, besides hostname, gpu_id and type. Series that become identical are summed.",
+).Default(strings.Join(optionalProcessLabels, ",")).String()
+
+var processCommandLabel = kingpin.Flag(
+	"collector.gpu_process.command-label",
+	"How the command label of GPU processes is set, as command lines may contain secrets: full command line, argv0 only, redact arguments but keep flag names, or a hash of the command line.",
+).Default("full").Enum("full", "argv0", "redact", "hash")
+
+var processEnvLabels = kingpin.Flag(
+	"collector.gpu_process.env-labels",
+	"Comma-separated environment variables of GPU processes to add as labels, e.g. CUDA_VISIBLE_DEVICES. The label is the lowercased name prefixed with env_.",
+).Default("").String()
+
+var maxProcessSeries = kingpin.Flag(
+	"collector.gpu_process.max-series",
+	"Maximum number of processes exported per scrape, 0 for no limit. Processes beyond the limit, smallest GPU memory users first, are summed into a series whose labels are set to overflow.",
+).Default("0").Int()
+
+var criSocket = kingpin.Flag(
+	"collector.gpu_process.cri-socket",
+	"Path to the CRI socket of the container runtime, used to name the containers of GPU processes.",
+).Default(cri.DefaultSocket).String()
+
+var dockerSocket = kingpin.Flag(
+	"collector.gpu_process.docker-socket",
+	"Path to the Docker socket, used instead of the CRI socket to name the containers of GPU processes when the latter doesn't exist.",
+).Default(docker.DefaultSocket).String()
+
+// containerIDPattern matches the container ID in the cgroup path of a
+// containerized process, e.g. cri-containerd-<id>.scope or docker/<id>.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+var invalidLabelCharacters = regexp.MustCompile(`[^a-z0-9_]`)
+
+// slurmJobPattern matches the job in the cgroup path slurmstepd places job
+// steps in, e.g. /slurm/uid_1000/job_42/step_0 with cgroup v1 or
+// /system.slice/slurmstepd.scope/job_42/step_0 with cgroup v2.
+var slurmJobPattern = regexp.MustCompile(`slurm[^\n]*/job_([0-9]+)\b`)
+
+// optionalProcessLabels are the labels of per-process series that can be
+// turned off with --collector.gpu_process.labels.
+var optionalProcessLabels = []string{
+	"pid", "process_name", "uid", "command",
+	"container_id", "container_name", "container_image",
+	"namespace", "pod",
+	"slurm_job_id", "slurm_user",
+	"gpu_instance_id", "compute_instance_id", "mig_uuid",
+	"cgroup",
+}
+
+var (
+	processSeriesLabels    = []string{"hostname", "gpu_id", "type", "pid", "process_name", "uid", "command", "container_id", "container_name", "container_image", "namespace", "pod", "slurm_job_id", "slurm_user", "gpu_instance_id", "compute_instance_id", "mig_uuid", "cgroup"}
+	accountingSeriesLabels = []string{"hostname", "gpu_id", "pid", "process_name", "uid", "command", "slurm_job_id", "slurm_user"}
+	encoderSeriesLabels    = []string{"hostname", "gpu_id", "pid", "process_name", "uid", "command", "codec"}
+	// gpuProcessLabels are the labels of per-process series that tell the
+	// GPUs of a process apart, which its host resource series don't have.
+	gpuProcessLabels = []string{"gpu_id", "type", "gpu_instance_id", "compute_instance_id", "mig_uuid"}
 )
 
+// processLabelSet is the set of labels per-process series are exported with.
+type processLabelSet map[string]bool
+
+func parseProcessLabels(flag string) (processLabelSet, error) {
+	labels := processLabelSet{"hostname": true, "gpu_id": true, "type": true, "codec": true}
+	for _, name := range strings.Split(flag, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(optionalProcessLabels, name) {
+			return nil, fmt.Errorf("unknown process label %q, must be one of %s", name, strings.Join(optionalProcessLabels, ", "))
+		}
+		labels[name] = true
+	}
+	return labels, nil
+}
+
+// names returns the enabled labels of names.
+func (s processLabelSet) names(names []string) []string {
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		if s[name] {
+			selected = append(selected, name)
+		}
+	}
+	return selected
+}
+
+// values returns the values of the enabled labels of names.
+func (s processLabelSet) values(names, values []string) []string {
+	selected := make([]string, 0, len(names))
+	for i, name := range names {
+		if s[name] {
+			selected = append(selected, values[i])
+		}
+	}
+	return selected
+}
+
 // GPUMetricsCollector manages Prometheus metrics for physical GPU resources.
 type gpuProcessCollector struct {
-	processGPUMem *prometheus.Desc
-	logger        *slog.Logger
+	processGPUMem       *prometheus.Desc
+	processCPUSeconds   *prometheus.Desc
+	processRSS          *prometheus.Desc
+	userGPUMem          *prometheus.Desc
+	nameGPUMem          *prometheus.Desc
+	unresolvedPIDs      *prometheus.Desc
+	seriesDropped       *prometheus.Desc
+	encoderSessions     *prometheus.Desc
+	encoderFPS          *prometheus.Desc
+	accountingGPUUtil   *prometheus.Desc
+	accountingMemUtil   *prometheus.Desc
+	accountingMaxMemory *prometheus.Desc
+	accountingRunning   *prometheus.Desc
+	suppressZero        bool
+	aggregate           string
+	labels              processLabelSet
+	seriesLabels        []string
+	envVars             []string
+	maxSeries           int
+	commandLabel        string
+	criSocket           string
+	cri                 *cri.Client
+	dockerSocket        string
+	docker              *docker.Client
+	processes           *processCache
+	logger              *slog.Logger
+
+	// dropped counts the processes summed into overflow series.
+	dropped atomic.Uint64
+	// warnedUnresolved is set once the exporter warned that no PID
+	// reported by NVML resolves through procfs.
+	warnedUnresolved atomic.Bool
+	// runtime is the index in containerRuntimes of the runtime containers
+	// were last listed from, which is tried first.
+	runtime atomic.Int32
 }
 
 func init() {
@@ -30,22 +191,114 @@ func init() {
 }
 
 func NewGPUProcessCollector(logger *slog.Logger) (Collector, error) {
+	labels, err := parseProcessLabels(*processLabelFlag)
+	if err != nil {
+		return nil, err
+	}
+	seriesLabels := slices.Clone(processSeriesLabels)
+	var envVars []string
+	for _, name := range strings.Split(*processEnvLabels, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		label := envLabelName(name)
+		if slices.Contains(seriesLabels, label) {
+			return nil, fmt.Errorf("environment variable %q is given twice as label %s", name, label)
+		}
+		envVars = append(envVars, name)
+		seriesLabels = append(seriesLabels, label)
+		labels[label] = true
+	}
+
 	return &gpuProcessCollector{
-		processGPUMem: prometheus.NewDesc(
+		processGPUMem: newDesc(
 			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "gpu_memory"),
-			"GPU process memory usage in bytes.",
-			[]string{"hostname", "gpu_id", "pid", "process_name", "uid", "command"}, nil,
+			"GPU process memory usage in bytes. type is compute, graphics or mps, for clients of the CUDA MPS server, joined with commas for processes with several kinds of contexts. The container, pod, Slurm and MIG labels are empty for processes outside of containers, Kubernetes pods, Slurm jobs and MIG devices.",
+			labels.names(seriesLabels), nil,
+		),
+		processCPUSeconds: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "cpu_seconds_total"),
+			"Host CPU time consumed by the GPU process in user and system mode, in seconds. Exported once per process, whichever GPUs it uses, and only while pid is a label, as a sum over processes would drop whenever one exits.",
+			hostProcessLabels(labels.names(seriesLabels)), nil,
+		),
+		processRSS: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "resident_memory_bytes"),
+			"Host resident memory of the GPU process in bytes. Exported once per process, whichever GPUs it uses.",
+			hostProcessLabels(labels.names(seriesLabels)), nil,
+		),
+		userGPUMem: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "user_gpu_memory"),
+			"GPU memory used by the processes of a user in bytes. Replaces the per-process series when aggregating by user.",
+			[]string{"hostname", "gpu_id", "uid", "user"}, nil,
+		),
+		nameGPUMem: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "name_gpu_memory"),
+			"GPU memory used by the processes of a name in bytes. Replaces the per-process series when aggregating by process name.",
+			[]string{"hostname", "gpu_id", "process_name"}, nil,
+		),
+		unresolvedPIDs: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "unresolved_pids"),
+			"Number of GPU processes whose host PID couldn't be found in procfs, and are therefore not exported. Non-zero when the exporter doesn't see the host PID namespace.",
+			[]string{"hostname"}, nil,
 		),
-		logger: logger,
+		seriesDropped: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "series_dropped_total"),
+			"Number of process series summed into the overflow series because of --collector.gpu_process.max-series.",
+			[]string{"hostname"}, nil,
+		),
+		encoderSessions: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "encoder_sessions"),
+			"Number of NVENC sessions of the process.",
+			labels.names(encoderSeriesLabels), nil,
+		),
+		encoderFPS: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "encoder_fps"),
+			"Frames per second encoded by the NVENC sessions of the process, summed over sessions.",
+			labels.names(encoderSeriesLabels), nil,
+		),
+		accountingGPUUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "accounting_gpu_utilization"),
+			"Average GPU utilization percentage of the process over its lifetime, from NVML accounting. Only exported while accounting mode is enabled.",
+			labels.names(accountingSeriesLabels), nil,
+		),
+		accountingMemUtil: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "accounting_memory_utilization"),
+			"Average GPU memory utilization percentage of the process over its lifetime, from NVML accounting.",
+			labels.names(accountingSeriesLabels), nil,
+		),
+		accountingMaxMemory: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "accounting_max_memory_bytes"),
+			"Maximum GPU memory used by the process in bytes, from NVML accounting.",
+			labels.names(accountingSeriesLabels), nil,
+		),
+		accountingRunning: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "accounting_running"),
+			"Whether the accounted process is still running. Exited processes are reported until NVML evicts them from its accounting buffer.",
+			labels.names(accountingSeriesLabels), nil,
+		),
+		suppressZero: *suppressZeroProcessMemory,
+		aggregate:    *aggregateProcesses,
+		labels:       labels,
+		seriesLabels: seriesLabels,
+		envVars:      envVars,
+		maxSeries:    *maxProcessSeries,
+		commandLabel: *processCommandLabel,
+		criSocket:    *criSocket,
+		cri:          cri.NewClient(*criSocket),
+		dockerSocket: *dockerSocket,
+		docker:       docker.NewClient(*dockerSocket),
+		processes:    newProcessCache(*processCommandLabel),
+		logger:       logger,
 	}, nil
 }
 
 func (c *gpuProcessCollector) Update(ch chan<- prometheus.Metric) error {
-	hostname := hostNameOrDefault(c.logger)
+	hostname := nodeName
+	defer c.processes.sweep()
 
 	usages, err := nvmlGPUProcessUsages(c.logger)
 	if err != nil {
-		if errors.Is(err, errGPUProcessInfoUnavailable) {
+		if errors.Is(err, errNVMLUnavailable) {
 			c.logger.Debug("gpu process listing unavailable", "err", err)
 			return nil
 		}
@@ -53,90 +306,485 @@ func (c *gpuProcessCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 	if len(usages) == 0 {
 		c.logger.Debug("no gpu processes reported")
-		return nil
 	}
 
-	metaCache := make(map[uint]processMetadata)
+	var containers map[string]containerMetadata
+	userUsages := make(map[userGPUKey]uint64)
+	nameUsages := make(map[nameGPUKey]uint64)
+	series := make(seriesSums)
+	unresolved := make(map[uint]bool)
+	resolved := 0
+	kept := make(map[string]bool)
+	// Processes using several GPUs are listed once per GPU, but their host
+	// resources are exported once.
+	hostExported := make(map[uint]bool)
+	labelNames := c.labels.names(c.seriesLabels)
+
+	if c.maxSeries > 0 {
+		// Keep the largest GPU memory users when the limit is hit.
+		sort.SliceStable(usages, func(i, j int) bool { return usages[i].memBytes > usages[j].memBytes })
+	}
 
 	for _, usage := range usages {
-		meta, ok := metaCache[usage.pid]
-		if !ok {
-			var metaErr error
-			meta, metaErr = collectProcessInfo(usage.pid, "")
-			if metaErr != nil {
-				c.logger.Debug("failed to collect host process info", "pid", usage.pid, "err", metaErr)
-				continue
+		if c.suppressZero && usage.memBytes == 0 {
+			continue
+		}
+
+		meta, err := c.processes.lookup(usage.pid)
+		if err != nil {
+			c.logger.Debug("failed to collect host process info", "pid", usage.pid, "err", err)
+			unresolved[usage.pid] = true
+			continue
+		}
+		resolved++
+
+		switch c.aggregate {
+		case "user":
+			userUsages[userGPUKey{gpu: usage.gpu, uid: meta.uid, user: meta.user}] += usage.memBytes
+			continue
+		case "process_name":
+			nameUsages[nameGPUKey{gpu: usage.gpu, name: meta.name}] += usage.memBytes
+			continue
+		}
+
+		var container containerMetadata
+		if meta.containerID != "" {
+			if containers == nil {
+				containers = c.containers()
 			}
-			metaCache[usage.pid] = meta
+			container = containers[meta.containerID]
 		}
 
-		labels := []string{
+		values := []string{
 			hostname,
 			strconv.FormatUint(uint64(usage.gpu), 10),
+			usage.typ,
 			strconv.FormatUint(uint64(usage.pid), 10),
 			meta.name,
 			meta.uid,
 			meta.command,
+			meta.containerID,
+			container.name,
+			container.image,
+			container.namespace,
+			container.pod,
+			meta.slurmJobID,
+			meta.slurmUser,
+			usage.gpuInstanceID,
+			usage.computeInstanceID,
+			usage.migUUID,
+			meta.cgroup,
+		}
+		for _, name := range c.envVars {
+			values = append(values, meta.env[name])
+		}
+		labels := c.labels.values(c.seriesLabels, values)
+		overflow := false
+		if c.maxSeries > 0 {
+			key := strings.Join(labels, "\xff")
+			if !kept[key] && len(kept) >= c.maxSeries {
+				labels = c.overflowLabels(labels)
+				overflow = true
+				c.dropped.Add(1)
+			} else {
+				kept[key] = true
+			}
+		}
+
+		series.add(c.processGPUMem, prometheus.GaugeValue, float64(usage.memBytes), labels)
+		if hostExported[usage.pid] {
+			continue
+		}
+		hostExported[usage.pid] = true
+		hostLabels := hostProcessLabelValues(labelNames, labels)
+		// Summed counters would go down when a process exits, which
+		// rate() takes for a reset.
+		if meta.cpuSeconds >= 0 && c.labels["pid"] && !overflow {
+			series.add(c.processCPUSeconds, prometheus.CounterValue, meta.cpuSeconds, hostLabels)
 		}
+		if meta.rssBytes >= 0 {
+			series.add(c.processRSS, prometheus.GaugeValue, meta.rssBytes, hostLabels)
+		}
+	}
+	series.collect(ch)
 
-		ch <- prometheus.MustNewConstMetric(
-			c.processGPUMem,
-			prometheus.GaugeValue,
-			sanitizeBytes(int64(usage.memBytes)),
-			labels...,
-		)
+	ch <- prometheus.MustNewConstMetric(c.seriesDropped, prometheus.CounterValue, float64(c.dropped.Load()), hostname)
+	ch <- prometheus.MustNewConstMetric(c.unresolvedPIDs, prometheus.GaugeValue, float64(len(unresolved)), hostname)
+	if len(unresolved) > 0 && resolved == 0 && c.warnedUnresolved.CompareAndSwap(false, true) {
+		c.logger.Warn("no GPU process PID resolves through procfs, run the exporter in the host PID namespace or mount the host /proc and pass it to --path.procfs", "procfs", *procPath)
+	}
+
+	for key, memBytes := range userUsages {
+		ch <- prometheus.MustNewConstMetric(c.userGPUMem, prometheus.GaugeValue, float64(memBytes),
+			hostname, strconv.FormatUint(uint64(key.gpu), 10), key.uid, key.user)
+	}
+	for key, memBytes := range nameUsages {
+		ch <- prometheus.MustNewConstMetric(c.nameGPUMem, prometheus.GaugeValue, float64(memBytes),
+			hostname, strconv.FormatUint(uint64(key.gpu), 10), key.name)
+	}
+
+	if err := c.updateEncoderSessions(ch, hostname); err != nil {
+		if errors.Is(err, errNVMLUnavailable) {
+			c.logger.Debug("gpu encoder sessions unavailable", "err", err)
+			return nil
+		}
+		return fmt.Errorf("collect encoder sessions: %w", err)
+	}
+
+	if err := c.updateAccounting(ch, hostname); err != nil {
+		if errors.Is(err, errNVMLUnavailable) {
+			c.logger.Debug("gpu process accounting unavailable", "err", err)
+			return nil
+		}
+		return fmt.Errorf("collect process accounting: %w", err)
 	}
 
 	return nil
 }
 
-var (
-	errGPUProcessInfoUnavailable = errors.New("gpu process list unavailable")
-)
+// overflowLabels returns the labels of the overflow series of the GPU of a
+// process series, which keeps only hostname and gpu_id.
+func (c *gpuProcessCollector) overflowLabels(labels []string) []string {
+	overflow := make([]string, len(labels))
+	for i, name := range c.labels.names(c.seriesLabels) {
+		switch name {
+		case "hostname", "gpu_id":
+			overflow[i] = labels[i]
+		default:
+			overflow[i] = "overflow"
+		}
+	}
+	return overflow
+}
+
+// hostProcessLabels returns names without the labels that tell the GPUs of
+// a process apart.
+func hostProcessLabels(names []string) []string {
+	return slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		return slices.Contains(gpuProcessLabels, name)
+	})
+}
+
+// hostProcessLabelValues returns the values of the labels hostProcessLabels
+// keeps of names.
+func hostProcessLabelValues(names, values []string) []string {
+	selected := make([]string, 0, len(values))
+	for i, name := range names {
+		if !slices.Contains(gpuProcessLabels, name) {
+			selected = append(selected, values[i])
+		}
+	}
+	return selected
+}
+
+// updateEncoderSessions exports the NVENC sessions of every process, which
+// break down the encoder utilization of gpu_process_utilization by codec on
+// transcoding hosts.
+func (c *gpuProcessCollector) updateEncoderSessions(ch chan<- prometheus.Metric, hostname string) error {
+	series := make(seriesSums)
+	err := collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		sessions, ret := gpu.device.GetEncoderSessions()
+		if ret != nvml.SUCCESS {
+			if ret != nvml.ERROR_NOT_SUPPORTED {
+				c.logger.Debug("failed to list encoder sessions", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			}
+			return
+		}
+		for _, session := range sessions {
+			pid := uint(session.Pid)
+			meta, err := c.processes.lookup(pid)
+			if err != nil {
+				c.logger.Debug("failed to collect host process info", "pid", pid, "err", err)
+				continue
+			}
+
+			labels := c.labels.values(encoderSeriesLabels, []string{
+				hostname,
+				strconv.Itoa(gpu.index),
+				strconv.FormatUint(uint64(pid), 10),
+				meta.name,
+				meta.uid,
+				meta.command,
+				encoderCodecName(nvml.EncoderType(session.CodecType)),
+			})
+			series.add(c.encoderSessions, prometheus.GaugeValue, 1, labels)
+			series.add(c.encoderFPS, prometheus.GaugeValue, float64(session.AverageFps), labels)
+		}
+	})
+	series.collect(ch)
+	return err
+}
+
+func encoderCodecName(codec nvml.EncoderType) string {
+	switch codec {
+	case nvml.ENCODER_QUERY_H264:
+		return "h264"
+	case nvml.ENCODER_QUERY_HEVC:
+		return "hevc"
+	case nvml.ENCODER_QUERY_AV1:
+		return "av1"
+	default:
+		return "unknown"
+	}
+}
+
+// updateAccounting exports the NVML accounting statistics of every GPU with
+// accounting mode enabled. NVML keeps statistics of exited processes in a
+// ring buffer, so short-lived processes that ran between scrapes show up too.
+func (c *gpuProcessCollector) updateAccounting(ch chan<- prometheus.Metric, hostname string) error {
+	release := lockNVML()
+	defer release()
+	gpus, err := gpuBackend.nvmlGPUs(c.logger)
+	if err != nil {
+		return err
+	}
+
+	series := make(seriesSums)
+	for _, gpu := range gpus {
+		i, device := gpu.index, gpu.device
+		mode, ret := device.GetAccountingMode()
+		if ret != nvml.SUCCESS || mode != nvml.FEATURE_ENABLED {
+			continue
+		}
+		pids, ret := device.GetAccountingPids()
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to list accounting pids", "gpu_index", i, "err", nvml.ErrorString(ret))
+			continue
+		}
+
+		seen := make(map[int]bool, len(pids))
+		for _, pid := range pids {
+			// A reused PID appears once per process, but NVML only
+			// returns statistics for the most recent one.
+			if seen[pid] {
+				continue
+			}
+			seen[pid] = true
+
+			stats, ret := device.GetAccountingStats(uint32(pid))
+			if ret != nvml.SUCCESS {
+				c.logger.Debug("failed to get accounting stats", "gpu_index", i, "pid", pid, "err", nvml.ErrorString(ret))
+				continue
+			}
+
+			meta, ok := c.processes.cached(uint(pid))
+			if !ok {
+				// Host metadata of exited processes is gone.
+				meta = processMetadata{name: unknownProcessLabel, uid: unknownProcessLabel, command: unknownProcessLabel}
+				if stats.IsRunning != 0 {
+					if info, err := c.processes.lookup(uint(pid)); err == nil {
+						meta = info
+					}
+				}
+			}
+
+			labels := c.labels.values(accountingSeriesLabels, []string{
+				hostname,
+				strconv.Itoa(i),
+				strconv.Itoa(pid),
+				meta.name,
+				meta.uid,
+				meta.command,
+				meta.slurmJobID,
+				meta.slurmUser,
+			})
+			// Utilizations, peaks and the running flag don't add up across
+			// processes, so merged series keep the highest value, and are
+			// running if any of their processes is.
+			series.max(c.accountingGPUUtil, prometheus.GaugeValue, float64(stats.GpuUtilization), labels)
+			series.max(c.accountingMemUtil, prometheus.GaugeValue, float64(stats.MemoryUtilization), labels)
+			series.max(c.accountingMaxMemory, prometheus.GaugeValue, float64(processMemoryBytes(stats.MaxMemoryUsage)), labels)
+			series.max(c.accountingRunning, prometheus.GaugeValue, boolToFloat(stats.IsRunning != 0), labels)
+		}
+	}
+	series.collect(ch)
+
+	return nil
+}
+
+// seriesSums merges the values of series with identical labels, which happens
+// when labels that tell processes apart are turned off.
+type seriesSums map[seriesKey]*seriesSum
+
+type seriesKey struct {
+	desc   *prometheus.Desc
+	labels string
+}
+
+type seriesSum struct {
+	valueType prometheus.ValueType
+	value     float64
+	labels    []string
+}
+
+func (s seriesSums) add(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels []string) {
+	key := seriesKey{desc: desc, labels: strings.Join(labels, "\xff")}
+	if sum, ok := s[key]; ok {
+		sum.value += value
+		return
+	}
+	s[key] = &seriesSum{valueType: valueType, value: value, labels: labels}
+}
+
+// max keeps the highest value of the series merged, for values that can't be
+// summed.
+func (s seriesSums) max(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels []string) {
+	key := seriesKey{desc: desc, labels: strings.Join(labels, "\xff")}
+	if sum, ok := s[key]; ok {
+		sum.value = max(sum.value, value)
+		return
+	}
+	s[key] = &seriesSum{valueType: valueType, value: value, labels: labels}
+}
+
+func (s seriesSums) collect(ch chan<- prometheus.Metric) {
+	for key, sum := range s {
+		ch <- prometheus.MustNewConstMetric(key.desc, sum.valueType, sum.value, sum.labels...)
+	}
+}
+
+type containerMetadata struct {
+	name  string
+	image string
+	// namespace and pod are empty for containers outside of Kubernetes.
+	namespace string
+	pod       string
+}
+
+// containerRuntime lists the containers of a container runtime reachable at
+// socket.
+type containerRuntime struct {
+	socket string
+	list   func(ctx context.Context) (map[string]containerMetadata, error)
+}
+
+func (c *gpuProcessCollector) containerRuntimes() []containerRuntime {
+	return []containerRuntime{
+		{c.criSocket, func(ctx context.Context) (map[string]containerMetadata, error) {
+			list, err := c.cri.Containers(ctx)
+			containers := make(map[string]containerMetadata, len(list))
+			for id, container := range list {
+				containers[id] = containerMetadata{name: container.Name, image: container.Image, namespace: container.Namespace, pod: container.Pod}
+			}
+			return containers, err
+		}},
+		{c.dockerSocket, func(ctx context.Context) (map[string]containerMetadata, error) {
+			list, err := c.docker.Containers(ctx)
+			containers := make(map[string]containerMetadata, len(list))
+			for id, container := range list {
+				containers[id] = containerMetadata{name: container.Name, image: container.Image, namespace: container.Namespace, pod: container.Pod}
+			}
+			return containers, err
+		}},
+	}
+}
+
+// containers returns the containers known to the container runtime, keyed by
+// container ID. The CRI API is tried first, then the Docker API, as Docker
+// hosts often have a containerd socket with the CRI plugin disabled. The
+// runtime that answered is tried first on later collections. It returns an
+// empty map if neither can be reached, so the container name and image stay
+// empty.
+func (c *gpuProcessCollector) containers() map[string]containerMetadata {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runtimes := c.containerRuntimes()
+	first := int(c.runtime.Load())
+	var errs []error
+	for i := range runtimes {
+		index := (first + i) % len(runtimes)
+		runtime := runtimes[index]
+		if !socketExists(runtime.socket) {
+			continue
+		}
+		containers, err := runtime.list(ctx)
+		if err != nil {
+			c.logger.Debug("failed to list containers", "socket", runtime.socket, "err", err)
+			errs = append(errs, fmt.Errorf("%s: %w", runtime.socket, err))
+			continue
+		}
+		c.runtime.Store(int32(index))
+		return containers
+	}
+	if len(errs) > 0 {
+		c.logger.Warn("failed to list containers", "err", errors.Join(errs...))
+	} else {
+		c.logger.Debug("no container runtime socket found, not resolving containers", "cri_socket", c.criSocket, "docker_socket", c.dockerSocket)
+	}
+	return make(map[string]containerMetadata)
+}
+
+func socketExists(path string) bool {
+	_, err := os.Stat(path)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+type userGPUKey struct {
+	gpu       uint
+	uid, user string
+}
+
+type nameGPUKey struct {
+	gpu  uint
+	name string
+}
 
 type processMetadata struct {
-	name    string
-	uid     string
-	command string
+	name        string
+	uid         string
+	user        string
+	command     string
+	containerID string
+	cgroup      string
+	slurmJobID  string
+	slurmUser   string
+	env         map[string]string
+	// cpuSeconds and rssBytes are negative if they couldn't be read.
+	cpuSeconds float64
+	rssBytes   float64
 }
 
 type gpuProcessUsage struct {
-	gpu      uint
-	pid      uint
+	gpu     uint
+	gpuUUID string
+	typ     string
+	pid     uint
+	// memBytes is 0 if NVML couldn't report the memory of the process.
 	memBytes uint64
+	// The MIG device the process runs on, empty outside of MIG.
+	gpuInstanceID     string
+	computeInstanceID string
+	migUUID           string
 }
 
 func nvmlGPUProcessUsages(logger *slog.Logger) ([]gpuProcessUsage, error) {
-	ret := nvml.Init()
-	if ret != nvml.SUCCESS {
-		return nil, wrapNVMLAvailabilityError("nvml init", ret)
-	}
-	defer func() {
-		if shutdownRet := nvml.Shutdown(); shutdownRet != nvml.SUCCESS {
-			logger.Debug("failed to shutdown nvml", "err", nvml.ErrorString(shutdownRet))
-		}
-	}()
+	release := lockNVML()
+	defer release()
+	return procBackend.gpuProcesses(logger)
+}
 
-	count, ret := nvml.DeviceGetCount()
-	if ret != nvml.SUCCESS {
-		return nil, wrapNVMLAvailabilityError("nvml device count", ret)
+func (b libraryBackend) gpuProcesses(logger *slog.Logger) ([]gpuProcessUsage, error) {
+	gpus, err := b.nvmlGPUs(logger)
+	if err != nil {
+		return nil, err
 	}
 
 	usages := make([]gpuProcessUsage, 0)
-	for i := 0; i < count; i++ {
-		device, ret := nvml.DeviceGetHandleByIndex(i)
-		if ret != nvml.SUCCESS {
-			return nil, fmt.Errorf("nvml device handle (index=%d): %s", i, nvml.ErrorString(ret))
+	for _, gpu := range gpus {
+		if err := appendNVMLProcessUsages(&usages, gpu.device.GetComputeRunningProcesses, "compute", gpu, logger); err != nil {
+			return nil, err
 		}
-
-		if err := appendNVMLProcessUsages(&usages, device.GetComputeRunningProcesses, "compute", i, logger); err != nil {
+		if err := appendNVMLProcessUsages(&usages, gpu.device.GetGraphicsRunningProcesses, "graphics", gpu, logger); err != nil {
 			return nil, err
 		}
-		if err := appendNVMLProcessUsages(&usages, device.GetGraphicsRunningProcesses, "graphics", i, logger); err != nil {
+		if err := appendNVMLProcessUsages(&usages, gpu.device.GetMPSComputeRunningProcesses, "mps", gpu, logger); err != nil {
 			return nil, err
 		}
 	}
+	attributeMIGDevices(usages, gpus, logger)
 
+	usages = mergeProcessUsages(usages)
 	sort.Slice(usages, func(i, j int) bool {
 		if usages[i].gpu == usages[j].gpu {
 			return usages[i].pid < usages[j].pid
@@ -147,9 +795,66 @@ func nvmlGPUProcessUsages(logger *slog.Logger) ([]gpuProcessUsage, error) {
 	return usages, nil
 }
 
+// mergeProcessUsages merges the usages NVML reports for a process in several
+// process lists, e.g. a CUDA application rendering with OpenGL. NVML reports
+// the memory of the whole process in each list, so the largest report is kept
+// rather than summing them, and the types are joined. Lists that couldn't
+// report the memory carry 0, see processMemoryBytes, so a reported value
+// wins over an unknown one.
+func mergeProcessUsages(usages []gpuProcessUsage) []gpuProcessUsage {
+	type key struct{ gpu, pid uint }
+	merged := make([]gpuProcessUsage, 0, len(usages))
+	index := make(map[key]int, len(usages))
+	for _, usage := range usages {
+		k := key{usage.gpu, usage.pid}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(merged)
+			merged = append(merged, usage)
+			continue
+		}
+		if !slices.Contains(strings.Split(merged[i].typ, ","), usage.typ) {
+			merged[i].typ += "," + usage.typ
+		}
+		merged[i].memBytes = max(merged[i].memBytes, usage.memBytes)
+	}
+	return merged
+}
+
+// attributeMIGDevices sets the MIG device UUID of usages on MIG devices of
+// gpus.
+func attributeMIGDevices(usages []gpuProcessUsage, gpus []nvmlGPU, logger *slog.Logger) {
+	devicesByIndex := make(map[uint]nvml.Device, len(gpus))
+	for _, gpu := range gpus {
+		devicesByIndex[uint(gpu.index)] = gpu.device
+	}
+	// MIG device UUIDs per GPU, keyed by GPU and compute instance ID.
+	uuids := make(map[uint]map[[2]string]string)
+	for i, usage := range usages {
+		if usage.gpuInstanceID == "" {
+			continue
+		}
+		byInstance, ok := uuids[usage.gpu]
+		if !ok {
+			byInstance = make(map[[2]string]string)
+			if device, ok := devicesByIndex[usage.gpu]; ok {
+				devices, err := migDevices(device)
+				if err != nil {
+					logger.Debug("failed to list mig devices", "gpu_index", usage.gpu, "err", err)
+				}
+				for _, mig := range devices {
+					byInstance[[2]string{strconv.Itoa(mig.gpuInstanceID), strconv.Itoa(mig.computeInstanceID)}] = mig.uuid
+				}
+			}
+			uuids[usage.gpu] = byInstance
+		}
+		usages[i].migUUID = byInstance[[2]string{usage.gpuInstanceID, usage.computeInstanceID}]
+	}
+}
+
 type nvmlProcessGetter func() ([]nvml.ProcessInfo, nvml.Return)
 
-func appendNVMLProcessUsages(dst *[]gpuProcessUsage, getter nvmlProcessGetter, typ string, gpuIndex int, logger *slog.Logger) error {
+func appendNVMLProcessUsages(dst *[]gpuProcessUsage, getter nvmlProcessGetter, typ string, gpu nvmlGPU, logger *slog.Logger) error {
 	processes, ret := getter()
 	switch ret {
 	case nvml.SUCCESS:
@@ -157,63 +862,91 @@ func appendNVMLProcessUsages(dst *[]gpuProcessUsage, getter nvmlProcessGetter, t
 			if info.Pid == 0 {
 				continue
 			}
-			*dst = append(*dst, gpuProcessUsage{
-				gpu:      uint(gpuIndex),
+			usage := gpuProcessUsage{
+				gpu:      uint(gpu.index),
+				gpuUUID:  gpu.uuid,
+				typ:      typ,
 				pid:      uint(info.Pid),
-				memBytes: info.UsedGpuMemory,
-			})
+				memBytes: processMemoryBytes(info.UsedGpuMemory),
+			}
+			// NVML sets the instance IDs to 0xFFFFFFFF outside of MIG.
+			if info.GpuInstanceId != math.MaxUint32 {
+				usage.gpuInstanceID = strconv.FormatUint(uint64(info.GpuInstanceId), 10)
+				usage.computeInstanceID = strconv.FormatUint(uint64(info.ComputeInstanceId), 10)
+			}
+			*dst = append(*dst, usage)
 		}
 		return nil
 	case nvml.ERROR_NOT_SUPPORTED, nvml.ERROR_NO_PERMISSION, nvml.ERROR_NOT_FOUND:
-		logger.Debug("nvml process info unavailable", "gpu_index", gpuIndex, "type", typ, "err", nvml.ErrorString(ret))
+		logger.Debug("nvml process info unavailable", "gpu_index", gpu.index, "type", typ, "err", nvml.ErrorString(ret))
 		return nil
 	default:
-		return fmt.Errorf("nvml %s running processes (gpu=%d): %s", typ, gpuIndex, nvml.ErrorString(ret))
-	}
-}
-
-func wrapNVMLAvailabilityError(op string, ret nvml.Return) error {
-	switch ret {
-	case nvml.ERROR_UNINITIALIZED,
-		nvml.ERROR_LIBRARY_NOT_FOUND,
-		nvml.ERROR_DRIVER_NOT_LOADED,
-		nvml.ERROR_NOT_SUPPORTED,
-		nvml.ERROR_NO_PERMISSION,
-		nvml.ERROR_UNKNOWN:
-		return fmt.Errorf("%s: %w (%s)", op, errGPUProcessInfoUnavailable, nvml.ErrorString(ret))
-	default:
-		return fmt.Errorf("%s: %s", op, nvml.ErrorString(ret))
+		return fmt.Errorf("nvml %s running processes (gpu=%d): %s", typ, gpu.index, nvml.ErrorString(ret))
 	}
 }
 
-func collectProcessInfo(pid uint, fallbackName string) (processMetadata, error) {
-	proc, err := process.NewProcess(int32(pid))
+// collectProcessInfo returns the host metadata of pid, with the command label
+// set according to commandLabel, see --collector.gpu_process.command-label.
+func collectProcessInfo(pid uint, fallbackName, commandLabel string) (processMetadata, error) {
+	ctx := procContext()
+	proc, err := process.NewProcessWithContext(ctx, int32(pid))
 	if err != nil {
 		return processMetadata{}, err
 	}
+	meta := staticProcessInfo(ctx, proc, pid, fallbackName, commandLabel)
+	meta.cpuSeconds, meta.rssBytes = processResources(ctx, proc)
+	return meta, nil
+}
 
-	name, err := proc.Name()
+// staticProcessInfo returns the metadata of proc that doesn't change while it
+// runs, leaving out its resource usage.
+func staticProcessInfo(ctx context.Context, proc *process.Process, pid uint, fallbackName, commandLabel string) processMetadata {
+	name, err := proc.NameWithContext(ctx)
 	if err != nil {
 		name = ""
 	}
 
 	uid := unknownProcessLabel
-	if uids, err := proc.Uids(); err == nil && len(uids) > 0 {
+	if uids, err := proc.UidsWithContext(ctx); err == nil && len(uids) > 0 {
 		uid = strconv.FormatInt(int64(uids[0]), 10)
 	}
 
-	cmdline, err := proc.Cmdline()
-	if err != nil || strings.TrimSpace(cmdline) == "" {
-		if args, err := proc.CmdlineSlice(); err == nil && len(args) > 0 {
-			cmdline = strings.Join(args, " ")
-		}
+	// The name is looked up in the exporter's passwd database, so it falls
+	// back to the uid for host users unknown inside the container.
+	username, err := proc.UsernameWithContext(ctx)
+	if err != nil {
+		username = ""
+	}
+
+	var cmdline string
+	if args, err := proc.CmdlineSliceWithContext(ctx); err == nil && len(args) > 0 {
+		cmdline = formatCommand(args, commandLabel)
+	} else if commandLabel == "full" {
+		cmdline, _ = proc.CmdlineWithContext(ctx)
 	}
 
 	meta := processMetadata{
 		name:    firstNonEmpty(name, fallbackName, unknownProcessLabel),
 		uid:     firstNonEmpty(uid, unknownProcessLabel),
+		user:    firstNonEmpty(username, uid, unknownProcessLabel),
 		command: firstNonEmpty(cmdline, name, fallbackName, unknownProcessLabel),
+		// The resource usage is read separately.
+		cpuSeconds: -1,
+		rssBytes:   -1,
 	}
+	cgroup := processCgroup(pid)
+	meta.cgroup = cgroupPath(cgroup)
+	meta.containerID = containerID(cgroup)
+	if environ, err := proc.EnvironWithContext(ctx); err == nil {
+		meta.env = make(map[string]string, len(environ))
+		for _, kv := range environ {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				meta.env[k] = v
+			}
+		}
+	}
+	meta.slurmJobID, meta.slurmUser = slurmJob(ctx, proc, cgroup, meta.env)
+
 	if limit := maxCommandLabelLength; len(meta.command) > limit {
 		runes := []rune(meta.command)
 		if len(runes) > limit {
@@ -222,10 +955,237 @@ func collectProcessInfo(pid uint, fallbackName string) (processMetadata, error)
 			meta.command = meta.command[:limit]
 		}
 	}
+	return meta
+}
+
+// processResources returns the CPU time and resident memory of proc, which
+// are negative if they couldn't be read.
+func processResources(ctx context.Context, proc *process.Process) (cpuSeconds, rssBytes float64) {
+	cpuSeconds, rssBytes = -1, -1
+	if times, err := proc.TimesWithContext(ctx); err == nil {
+		cpuSeconds = times.User + times.System
+	}
+	if mem, err := proc.MemoryInfoWithContext(ctx); err == nil {
+		rssBytes = float64(mem.RSS)
+	}
+	return cpuSeconds, rssBytes
+}
+
+// processCache keeps the metadata of GPU processes across collections, as
+// reading the environment, cgroup and command line of every process on every
+// scrape made up most of the garbage of a collection. Only the resource usage
+// is read again, once per collection however often the process is looked up,
+// e.g. for each of its GPUs and encoder sessions. Entries are keyed by PID and
+// start time, so a reused PID is looked up afresh, and are dropped by the
+// first sweep that finds them unused since the previous one.
+type processCache struct {
+	commandLabel string
+
+	mtx     sync.Mutex
+	entries map[uint]*processCacheEntry
+	// failed holds the PIDs that couldn't be looked up in this collection.
+	failed map[uint]error
+	// generation is incremented by every sweep.
+	generation uint64
+}
+
+type processCacheEntry struct {
+	created int64
+	// meta holds the resource usage read in generation read.
+	meta       processMetadata
+	read       uint64
+	generation uint64
+}
+
+func newProcessCache(commandLabel string) *processCache {
+	return &processCache{
+		commandLabel: commandLabel,
+		entries:      make(map[uint]*processCacheEntry),
+		failed:       make(map[uint]error),
+	}
+}
+
+// lookup returns the metadata of pid with its resource usage, which is read
+// on the first lookup of a collection.
+func (c *processCache) lookup(pid uint) (processMetadata, error) {
+	c.mtx.Lock()
+	if err, ok := c.failed[pid]; ok {
+		c.mtx.Unlock()
+		return processMetadata{}, err
+	}
+	if entry, ok := c.entries[pid]; ok && entry.read == c.generation {
+		entry.generation = c.generation
+		meta := entry.meta
+		c.mtx.Unlock()
+		return meta, nil
+	}
+	c.mtx.Unlock()
 
+	ctx := procContext()
+	proc, err := process.NewProcessWithContext(ctx, int32(pid))
+	if err != nil {
+		c.mtx.Lock()
+		c.failed[pid] = err
+		c.mtx.Unlock()
+		return processMetadata{}, err
+	}
+	created, err := proc.CreateTimeWithContext(ctx)
+	if err != nil {
+		created = -1
+	}
+
+	c.mtx.Lock()
+	entry, ok := c.entries[pid]
+	c.mtx.Unlock()
+	var meta processMetadata
+	if ok && created >= 0 && entry.created == created {
+		meta = entry.meta
+	} else {
+		meta = staticProcessInfo(ctx, proc, pid, "", c.commandLabel)
+	}
+	meta.cpuSeconds, meta.rssBytes = processResources(ctx, proc)
+
+	c.mtx.Lock()
+	c.entries[pid] = &processCacheEntry{
+		created:    created,
+		meta:       meta,
+		read:       c.generation,
+		generation: c.generation,
+	}
+	c.mtx.Unlock()
 	return meta, nil
 }
 
+// cached returns the metadata of pid from the last lookup, without reading
+// procfs, e.g. for processes that have exited since.
+func (c *processCache) cached(pid uint) (processMetadata, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	entry, ok := c.entries[pid]
+	if !ok {
+		return processMetadata{}, false
+	}
+	entry.generation = c.generation
+	return entry.meta, true
+}
+
+// sweep drops the entries not looked up since the previous sweep. It is
+// called once per collection.
+func (c *processCache) sweep() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for pid, entry := range c.entries {
+		if entry.generation != c.generation {
+			delete(c.entries, pid)
+		}
+	}
+	c.generation++
+	clear(c.failed)
+}
+
+// processCgroup returns the contents of /proc/<pid>/cgroup, or "" if it
+// can't be read.
+func processCgroup(pid uint) string {
+	data, err := os.ReadFile(procFilePath(strconv.FormatUint(uint64(pid), 10), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// cgroupPath returns the cgroup a process is in, given /proc/<pid>/cgroup:
+// the unified hierarchy path with cgroup v2, or the memory controller path
+// with cgroup v1.
+func cgroupPath(cgroup string) string {
+	var memory, first string
+	for _, line := range strings.Split(cgroup, "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" && parts[2] != "/" {
+			return parts[2]
+		}
+		if slices.Contains(strings.Split(parts[1], ","), "memory") {
+			memory = parts[2]
+		}
+		if first == "" {
+			first = parts[2]
+		}
+	}
+	return cmp.Or(memory, first)
+}
+
+// containerID returns the ID of the container a process is in, given
+// /proc/<pid>/cgroup, or "" outside of containers. Nested containers are
+// listed outermost first, so the innermost ID is taken.
+func containerID(cgroup string) string {
+	if ids := containerIDPattern.FindAllString(cgroup, -1); len(ids) > 0 {
+		return ids[len(ids)-1]
+	}
+	return ""
+}
+
+// slurmJob returns the ID and user of the Slurm job running proc, or empty
+// strings outside of Slurm jobs. The job is taken from the cgroup slurmstepd
+// placed the process in, falling back to SLURM_JOB_ID in its environment for
+// clusters without the cgroup plugin.
+func slurmJob(ctx context.Context, proc *process.Process, cgroup string, env map[string]string) (jobID, user string) {
+	if m := slurmJobPattern.FindStringSubmatch(cgroup); m != nil {
+		jobID = m[1]
+	} else {
+		jobID = env["SLURM_JOB_ID"]
+	}
+	if jobID == "" {
+		return "", ""
+	}
+
+	user = env["SLURM_JOB_USER"]
+	if user == "" {
+		if name, err := proc.UsernameWithContext(ctx); err == nil {
+			user = name
+		}
+	}
+	return jobID, firstNonEmpty(user, unknownProcessLabel)
+}
+
+// formatCommand joins args into the command label, see
+// --collector.gpu_process.command-label.
+func formatCommand(args []string, mode string) string {
+	switch mode {
+	case "argv0":
+		return args[0]
+	case "redact":
+		redacted := []string{args[0]}
+		for _, arg := range args[1:] {
+			switch {
+			case !strings.HasPrefix(arg, "-"):
+				arg = redactedArgument
+			case strings.HasPrefix(arg, "--"):
+				if flag, _, ok := strings.Cut(arg, "="); ok {
+					arg = flag + "=" + redactedArgument
+				}
+			case len(arg) > 2:
+				// Short flags may carry their value attached, as in
+				// mysql -psecret.
+				arg = arg[:2] + redactedArgument
+			}
+			redacted = append(redacted, arg)
+		}
+		return strings.Join(redacted, " ")
+	case "hash":
+		sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	default:
+		return strings.Join(args, " ")
+	}
+}
+
+// envLabelName returns the label an environment variable is exported as.
+func envLabelName(name string) string {
+	return "env_" + invalidLabelCharacters.ReplaceAllString(strings.ToLower(name), "_")
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, val := range values {
 		if strings.TrimSpace(val) != "" {
@@ -235,9 +1195,12 @@ func firstNonEmpty(values ...string) string {
 	return ""
 }
 
-func sanitizeBytes(value int64) float64 {
-	if value <= 0 {
+// processMemoryBytes returns the GPU memory NVML reports for a process, or 0
+// if NVML reports VALUE_NOT_AVAILABLE, e.g. for processes of other containers
+// or under WDDM. The sentinel must not reach sums or comparisons.
+func processMemoryBytes(used uint64) uint64 {
+	if int64(used) == nvml.VALUE_NOT_AVAILABLE {
 		return 0
 	}
-	return float64(value)
+	return used
 }
@@ -0,0 +1,274 @@
+package collector
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var processLaunchInterval = kingpin.Flag(
+	"collector.gpu_process_launches.interval",
+	"How often to poll NVML for GPU process launches, 0 to disable. Processes that exit between polls are only seen on GPUs with accounting mode enabled.",
+).Default("0s").Duration()
+
+// processLaunchPeakBuckets cover peak GPU memory from 64MiB to 128GiB.
+var processLaunchPeakBuckets = prometheus.ExponentialBuckets(64<<20, 2, 12)
+
+// gpuProcessLaunchesCollector counts GPU process launches per user and
+// process name, including processes too short-lived to show up in a scrape.
+// It polls NVML in the background at a higher rate than scrapes, and also
+// picks up processes that came and went between polls from the NVML
+// accounting buffer of GPUs with accounting mode enabled.
+type gpuProcessLaunchesCollector struct {
+	launches   *prometheus.Desc
+	peakMemory *prometheus.Desc
+	logger     *slog.Logger
+
+	mtx    sync.Mutex
+	counts map[processLaunchKey]*processLaunchCounts
+	// running are the processes seen by the previous poll.
+	running map[processKey]*runningProcess
+	// accounted are the accounting records already counted, which NVML
+	// keeps until they are evicted from its buffer.
+	accounted map[accountingKey]bool
+	// primed is set after the first poll.
+	primed bool
+}
+
+type processKey struct {
+	gpu int
+	pid uint32
+}
+
+type accountingKey struct {
+	processKey
+	startTime uint64
+}
+
+type processLaunchKey struct {
+	gpu       int
+	uid, name string
+}
+
+type processLaunchCounts struct {
+	launches float64
+	// peakCount, peakSum and peakBuckets make up the peak memory histogram
+	// of the launches that exited.
+	peakCount   uint64
+	peakSum     float64
+	peakBuckets map[float64]uint64
+}
+
+type runningProcess struct {
+	key  processLaunchKey
+	peak uint64
+	// counted is unset for processes that were running before the
+	// exporter started.
+	counted bool
+}
+
+func init() {
+	registerCollector("gpu_process_launches", NewGPUProcessLaunchesCollector)
+}
+
+func NewGPUProcessLaunchesCollector(logger *slog.Logger) (Collector, error) {
+	c := &gpuProcessLaunchesCollector{
+		launches: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "launches_total"),
+			"Number of processes that started using the GPU since the exporter started.",
+			[]string{"hostname", "gpu_id", "uid", "process_name"}, nil,
+		),
+		peakMemory: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "launch_peak_memory_bytes"),
+			"Peak GPU memory of processes that exited, in bytes.",
+			[]string{"hostname", "gpu_id", "uid", "process_name"}, nil,
+		),
+		logger:    logger,
+		counts:    make(map[processLaunchKey]*processLaunchCounts),
+		running:   make(map[processKey]*runningProcess),
+		accounted: make(map[accountingKey]bool),
+	}
+	return c, nil
+}
+
+// start polls the processes in the background if
+// --collector.gpu_process_launches.interval is set.
+func (c *gpuProcessLaunchesCollector) start() error {
+	if interval := *processLaunchInterval; interval > 0 {
+		go c.watch(interval)
+	}
+	return nil
+}
+
+func (c *gpuProcessLaunchesCollector) Update(ch chan<- prometheus.Metric) error {
+	hostname := nodeName
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for key, counts := range c.counts {
+		labels := []string{hostname, strconv.Itoa(key.gpu), key.uid, key.name}
+		ch <- prometheus.MustNewConstMetric(c.launches, prometheus.CounterValue, counts.launches, labels...)
+		ch <- prometheus.MustNewConstHistogram(c.peakMemory, counts.peakCount, counts.peakSum, counts.peakBuckets, labels...)
+	}
+	return nil
+}
+
+// watch polls for process launches until the exporter exits.
+func (c *gpuProcessLaunchesCollector) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := c.poll(); err != nil {
+			c.logger.Debug("failed to poll gpu process launches", "err", err)
+		}
+	}
+}
+
+func (c *gpuProcessLaunchesCollector) poll() error {
+	seen := make(map[processKey]uint64)
+	var records []accountingRecord
+	err := collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		for _, list := range []func() ([]nvml.ProcessInfo, nvml.Return){
+			gpu.device.GetComputeRunningProcesses,
+			gpu.device.GetGraphicsRunningProcesses,
+			gpu.device.GetMPSComputeRunningProcesses,
+		} {
+			processes, ret := list()
+			if ret != nvml.SUCCESS {
+				continue
+			}
+			for _, process := range processes {
+				if process.Pid != 0 {
+					key := processKey{gpu: gpu.index, pid: process.Pid}
+					seen[key] = max(seen[key], processMemoryBytes(process.UsedGpuMemory))
+				}
+			}
+		}
+		records = append(records, accountingRecords(gpu)...)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Processes started before the exporter aren't launches.
+	primed := c.primed
+	c.primed = true
+
+	// Processes that came and went between polls are only in the
+	// accounting buffer. Their host metadata is gone, so they are counted
+	// with unknown labels. Records of processes seen running are counted
+	// by the running processes below.
+	current := make(map[accountingKey]bool, len(records))
+	for _, record := range records {
+		current[record.key] = true
+		if c.accounted[record.key] {
+			continue
+		}
+		c.accounted[record.key] = true
+		if _, ok := c.running[record.key.processKey]; ok || record.running || !primed {
+			continue
+		}
+		launch := processLaunchKey{gpu: record.key.gpu, uid: unknownProcessLabel, name: unknownProcessLabel}
+		c.launch(launch)
+		c.exit(launch, record.maxMemory)
+	}
+	// Forget the records NVML evicted from its buffer.
+	for key := range c.accounted {
+		if !current[key] {
+			delete(c.accounted, key)
+		}
+	}
+
+	for key, memBytes := range seen {
+		process, ok := c.running[key]
+		if !ok {
+			process = &runningProcess{key: c.launchKey(key), counted: primed}
+			c.running[key] = process
+			if process.counted {
+				c.launch(process.key)
+			}
+		}
+		process.peak = max(process.peak, memBytes)
+	}
+	for key, process := range c.running {
+		if _, ok := seen[key]; !ok {
+			delete(c.running, key)
+			if process.counted {
+				c.exit(process.key, process.peak)
+			}
+		}
+	}
+	return nil
+}
+
+type accountingRecord struct {
+	key       accountingKey
+	running   bool
+	maxMemory uint64
+}
+
+// accountingRecords returns the NVML accounting records of gpu, if it has
+// accounting mode enabled.
+func accountingRecords(gpu nvmlGPU) []accountingRecord {
+	if mode, ret := gpu.device.GetAccountingMode(); ret != nvml.SUCCESS || mode != nvml.FEATURE_ENABLED {
+		return nil
+	}
+	pids, ret := gpu.device.GetAccountingPids()
+	if ret != nvml.SUCCESS {
+		return nil
+	}
+	records := make([]accountingRecord, 0, len(pids))
+	for _, pid := range pids {
+		stats, ret := gpu.device.GetAccountingStats(uint32(pid))
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		records = append(records, accountingRecord{
+			key:       accountingKey{processKey{gpu: gpu.index, pid: uint32(pid)}, stats.StartTime},
+			running:   stats.IsRunning != 0,
+			maxMemory: processMemoryBytes(stats.MaxMemoryUsage),
+		})
+	}
+	return records
+}
+
+// launchKey returns the labels a process is counted with.
+func (c *gpuProcessLaunchesCollector) launchKey(key processKey) processLaunchKey {
+	launch := processLaunchKey{gpu: key.gpu, uid: unknownProcessLabel, name: unknownProcessLabel}
+	if meta, err := collectProcessInfo(uint(key.pid), "", "argv0"); err == nil {
+		launch.uid, launch.name = meta.uid, meta.name
+	}
+	return launch
+}
+
+func (c *gpuProcessLaunchesCollector) launch(key processLaunchKey) {
+	counts, ok := c.counts[key]
+	if !ok {
+		counts = &processLaunchCounts{peakBuckets: make(map[float64]uint64, len(processLaunchPeakBuckets))}
+		for _, bound := range processLaunchPeakBuckets {
+			counts.peakBuckets[bound] = 0
+		}
+		c.counts[key] = counts
+	}
+	counts.launches++
+}
+
+func (c *gpuProcessLaunchesCollector) exit(key processLaunchKey, peak uint64) {
+	counts := c.counts[key]
+	counts.peakCount++
+	counts.peakSum += float64(peak)
+	for _, bound := range processLaunchPeakBuckets {
+		if float64(peak) <= bound {
+			counts.peakBuckets[bound]++
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFormatCommand(t *testing.T) {
+	args := []string{"/usr/bin/mysql", "-uroot", "-psecret", "-h", "db", "--password=secret", "--verbose", "-Hauthorization:token", "-", "query.sql"}
+	for _, tc := range []struct {
+		mode string
+		want string
+	}{
+		{mode: "full", want: "/usr/bin/mysql -uroot -psecret -h db --password=secret --verbose -Hauthorization:token - query.sql"},
+		{mode: "argv0", want: "/usr/bin/mysql"},
+		{mode: "redact", want: "/usr/bin/mysql -u<redacted> -p<redacted> -h <redacted> --password=<redacted> --verbose -H<redacted> - <redacted>"},
+		{mode: "hash", want: "sha256:ab00bed7f03fa9ac"},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			if got := formatCommand(args, tc.mode); got != tc.want {
+				t.Errorf("formatCommand(%q) = %q, want %q", tc.mode, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeProcessUsages(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		usages []gpuProcessUsage
+		want   []gpuProcessUsage
+	}{
+		{
+			name: "distinct processes",
+			usages: []gpuProcessUsage{
+				{gpu: 0, pid: 1, typ: "compute", memBytes: 10},
+				{gpu: 0, pid: 2, typ: "compute", memBytes: 20},
+				{gpu: 1, pid: 1, typ: "compute", memBytes: 30},
+			},
+			want: []gpuProcessUsage{
+				{gpu: 0, pid: 1, typ: "compute", memBytes: 10},
+				{gpu: 0, pid: 2, typ: "compute", memBytes: 20},
+				{gpu: 1, pid: 1, typ: "compute", memBytes: 30},
+			},
+		},
+		{
+			name: "several lists",
+			usages: []gpuProcessUsage{
+				{gpu: 0, pid: 1, typ: "compute", memBytes: 10},
+				{gpu: 0, pid: 1, typ: "graphics", memBytes: 30},
+				{gpu: 0, pid: 1, typ: "graphics", memBytes: 20},
+			},
+			want: []gpuProcessUsage{
+				{gpu: 0, pid: 1, typ: "compute,graphics", memBytes: 30},
+			},
+		},
+		{
+			name: "unknown memory",
+			usages: []gpuProcessUsage{
+				{gpu: 0, pid: 1, typ: "compute", memBytes: 10},
+				{gpu: 0, pid: 1, typ: "mps", memBytes: processMemoryBytes(math.MaxUint64)},
+			},
+			want: []gpuProcessUsage{
+				{gpu: 0, pid: 1, typ: "compute,mps", memBytes: 10},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mergeProcessUsages(tc.usages); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("mergeProcessUsages() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessMemoryBytes(t *testing.T) {
+	for _, tc := range []struct {
+		used, want uint64
+	}{
+		{used: 0, want: 0},
+		{used: 1 << 30, want: 1 << 30},
+		{used: math.MaxUint64, want: 0},
+	} {
+		if got := processMemoryBytes(tc.used); got != tc.want {
+			t.Errorf("processMemoryBytes(%d) = %d, want %d", tc.used, got, tc.want)
+		}
+	}
+}
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestCgroupPath(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{name: "v2", cgroup: "0::/kubepods.slice/cri-containerd-" + testContainerID + ".scope\n", want: "/kubepods.slice/cri-containerd-" + testContainerID + ".scope"},
+		{name: "v2 root", cgroup: "0::/\n", want: "/"},
+		{name: "v1 memory", cgroup: "12:cpu,cpuacct:/cpu\n11:memory:/docker/" + testContainerID + "\n", want: "/docker/" + testContainerID},
+		{name: "v1 without memory", cgroup: "12:cpu,cpuacct:/cpu\n11:pids:/pids\n", want: "/cpu"},
+		{name: "hybrid", cgroup: "1:name=systemd:/user.slice\n0::/user.slice/session-1.scope\n", want: "/user.slice/session-1.scope"},
+		{name: "empty", cgroup: "", want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := cgroupPath(tc.cgroup); got != tc.want {
+				t.Errorf("cgroupPath() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestContainerID(t *testing.T) {
+	inner := "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	for _, tc := range []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{name: "containerd", cgroup: "0::/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + testContainerID + ".scope\n", want: testContainerID},
+		{name: "docker", cgroup: "11:memory:/docker/" + testContainerID + "\n", want: testContainerID},
+		{name: "nested", cgroup: "0::/docker/" + testContainerID + "/docker/" + inner + "\n", want: inner},
+		{name: "host", cgroup: "0::/user.slice/session-1.scope\n", want: ""},
+		{name: "short id", cgroup: "0::/docker/0123456789ab\n", want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := containerID(tc.cgroup); got != tc.want {
+				t.Errorf("containerID() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSlurmJob(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cgroup   string
+		env      map[string]string
+		wantJob  string
+		wantUser string
+	}{
+		{name: "cgroup v1", cgroup: "4:memory:/slurm/uid_1000/job_42/step_0\n", env: map[string]string{"SLURM_JOB_USER": "alice"}, wantJob: "42", wantUser: "alice"},
+		{name: "cgroup v2", cgroup: "0::/system.slice/slurmstepd.scope/job_7/step_batch/user/task_0\n", env: map[string]string{"SLURM_JOB_USER": "bob"}, wantJob: "7", wantUser: "bob"},
+		{name: "cgroup over environment", cgroup: "0::/system.slice/slurmstepd.scope/job_7/step_0\n", env: map[string]string{"SLURM_JOB_ID": "8", "SLURM_JOB_USER": "bob"}, wantJob: "7", wantUser: "bob"},
+		{name: "environment", cgroup: "0::/user.slice\n", env: map[string]string{"SLURM_JOB_ID": "9", "SLURM_JOB_USER": "carol"}, wantJob: "9", wantUser: "carol"},
+		{name: "no job", cgroup: "0::/job_42\n", env: map[string]string{"SLURM_JOB_USER": "alice"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The process is only asked for its user when the environment
+			// doesn't name it.
+			job, user := slurmJob(context.Background(), nil, tc.cgroup, tc.env)
+			if job != tc.wantJob || user != tc.wantUser {
+				t.Errorf("slurmJob() = %q, %q, want %q, %q", job, user, tc.wantJob, tc.wantUser)
+			}
+		})
+	}
+}
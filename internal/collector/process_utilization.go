@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gpuProcessUtilizationCollector exports the SM, memory, encoder and decoder
+// utilization of every process, which answers which process is keeping a
+// GPU busy where per-process memory can't.
+type gpuProcessUtilizationCollector struct {
+	utilization *prometheus.Desc
+	processes   *processCache
+	logger      *slog.Logger
+
+	mtx sync.Mutex
+	// lastSeen holds the timestamp of the newest sample read per GPU index,
+	// so every scrape averages only the samples taken since the previous one.
+	lastSeen map[int]uint64
+}
+
+func init() {
+	registerCollector("gpu_process_utilization", NewGPUProcessUtilizationCollector)
+}
+
+func NewGPUProcessUtilizationCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuProcessUtilizationCollector{
+		utilization: newDesc(
+			prometheus.BuildFQName(namespace, GPUProcessSubsystem, "utilization"),
+			"Average utilization percentage of a GPU engine by the process since the previous scrape. Processes holding a context without using the GPU are reported at 0.",
+			[]string{"hostname", "gpu_id", "pid", "process_name", "uid", "command", "engine"}, nil,
+		),
+		processes: newProcessCache(*processCommandLabel),
+		logger:    logger,
+		lastSeen:  make(map[int]uint64),
+	}, nil
+}
+
+// processUtilization sums the utilization samples of a process.
+type processUtilization struct {
+	samples                      int
+	sm, memory, encoder, decoder float64
+}
+
+func (c *gpuProcessUtilizationCollector) Update(ch chan<- prometheus.Metric) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	defer c.processes.sweep()
+	return collectNVMLGPUs(c.logger, func(gpu nvmlGPU) {
+		samples, ret := gpu.device.GetProcessUtilization(c.lastSeen[gpu.index])
+		if ret == nvml.ERROR_NOT_FOUND {
+			// No process used the GPU since the previous scrape.
+			samples, ret = nil, nvml.SUCCESS
+		}
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read process utilization", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+
+		byPID := make(map[uint32]*processUtilization)
+		for _, sample := range samples {
+			if sample.TimeStamp > c.lastSeen[gpu.index] {
+				c.lastSeen[gpu.index] = sample.TimeStamp
+			}
+			if sample.Pid == 0 {
+				continue
+			}
+			util, ok := byPID[sample.Pid]
+			if !ok {
+				util = &processUtilization{}
+				byPID[sample.Pid] = util
+			}
+			util.samples++
+			util.sm += float64(sample.SmUtil)
+			util.memory += float64(sample.MemUtil)
+			util.encoder += float64(sample.EncUtil)
+			util.decoder += float64(sample.DecUtil)
+		}
+
+		// NVML only samples processes while they use an engine. Report
+		// processes holding a context without any sample as idle, so GPUs
+		// whose memory is held by idle jobs stand out.
+		for _, pid := range runningPIDs(gpu.device) {
+			if _, ok := byPID[pid]; !ok {
+				byPID[pid] = &processUtilization{}
+			}
+		}
+
+		for pid, util := range byPID {
+			meta, err := c.processes.lookup(uint(pid))
+			if err != nil {
+				c.logger.Debug("failed to collect host process info", "pid", pid, "err", err)
+				continue
+			}
+
+			labels := []string{
+				gpu.labels[0],
+				gpu.labels[1],
+				strconv.FormatUint(uint64(pid), 10),
+				meta.name,
+				meta.uid,
+				meta.command,
+			}
+			n := float64(max(util.samples, 1))
+			ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, util.sm/n, withLabels(labels, "sm")...)
+			ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, util.memory/n, withLabels(labels, "memory")...)
+			ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, util.encoder/n, withLabels(labels, "encoder")...)
+			ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, util.decoder/n, withLabels(labels, "decoder")...)
+		}
+	})
+}
+
+// runningPIDs returns the processes with a compute, graphics or MPS context on
+// device.
+func runningPIDs(device nvml.Device) []uint32 {
+	var pids []uint32
+	for _, list := range []func() ([]nvml.ProcessInfo, nvml.Return){
+		device.GetComputeRunningProcesses,
+		device.GetGraphicsRunningProcesses,
+		device.GetMPSComputeRunningProcesses,
+	} {
+		processes, ret := list()
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		for _, process := range processes {
+			if process.Pid != 0 {
+				pids = append(pids, process.Pid)
+			}
+		}
+	}
+	return pids
+}
@@ -0,0 +1,347 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/kube"
+)
+
+const (
+	GPURecoverySubsystem = "recovery"
+
+	recoveryEventTypes = nvml.EventTypeXidCriticalError |
+		nvml.EventTypeDoubleBitEccError |
+		nvml.EventTypeDramRetirementEvent |
+		nvml.EventTypeDramRetirementFailure |
+		nvml.EventTypeGpuUnavailableError |
+		nvml.EventTypeGpuRecoveryAction
+
+	// recoveryEventWait bounds a single wait for NVML events, so a lost
+	// driver is noticed even while no events arrive.
+	recoveryEventWait = 5 * time.Second
+	// recoveryRetryInterval is the pause before listening again after NVML
+	// failed, e.g. while the driver is being reloaded.
+	recoveryRetryInterval = 30 * time.Second
+	// recoveryNotifyInterval is how long repeats of an event with the same
+	// GPU and reason are collapsed into the next Kubernetes event.
+	recoveryNotifyInterval = 10 * time.Minute
+	// recoveryNotifyQueue bounds the Kubernetes events waiting to be
+	// recorded.
+	recoveryNotifyQueue = 16
+)
+
+var recoveryKubernetesEvents = kingpin.Flag(
+	"collector.gpu_recovery.kubernetes-events",
+	"Record a Warning event on the Kubernetes node for XID errors, double bit ECC errors and row remapping failures. Requires running in a pod allowed to create events.",
+).Default("false").Bool()
+
+var (
+	recoveryActionNames = map[nvml.DeviceGpuRecoveryAction]string{
+		nvml.GPU_RECOVERY_ACTION_NONE:            "none",
+		nvml.GPU_RECOVERY_ACTION_GPU_RESET:       "gpu_reset",
+		nvml.GPU_RECOVERY_ACTION_NODE_REBOOT:     "node_reboot",
+		nvml.GPU_RECOVERY_ACTION_DRAIN_P2P:       "drain_p2p",
+		nvml.GPU_RECOVERY_ACTION_DRAIN_AND_RESET: "drain_and_reset",
+	}
+	recoveryECCEventNames = map[uint64]string{
+		nvml.EventTypeDoubleBitEccError:     "double_bit_error",
+		nvml.EventTypeDramRetirementEvent:   "dram_retirement",
+		nvml.EventTypeDramRetirementFailure: "dram_retirement_failure",
+	}
+)
+
+// gpuRecoveryCollector counts GPU recovery related NVML events, so job
+// failures can be correlated with GPU resets and ECC recoveries. NVML only
+// delivers events to a registered listener, so the collector listens in the
+// background for the lifetime of the exporter and only counts events seen
+// since it started. Optionally, critical errors such as XIDs are also
+// recorded as Kubernetes events on the node.
+type gpuRecoveryCollector struct {
+	recoveryActions   *prometheus.Desc
+	eccEvents         *prometheus.Desc
+	unavailableErrors *prometheus.Desc
+	driverReinits     *prometheus.Desc
+	kube              *kube.Client
+	logger            *slog.Logger
+
+	// lost is set by the listener when it loses NVML, so the next listener
+	// counts a driver reinitialization.
+	lost bool
+
+	// notices queues the Kubernetes events for the worker recording them.
+	// notified holds when an event was last queued per GPU and reason, and
+	// repeats the events collapsed since. Only the listener uses them.
+	notices  chan recoveryNotice
+	notified map[recoveryEventKey]time.Time
+	repeats  map[recoveryEventKey]int
+
+	mtx               sync.Mutex
+	actions           map[recoveryEventKey]float64
+	ecc               map[recoveryEventKey]float64
+	unavailable       map[int]float64
+	reinitializations float64
+}
+
+type recoveryEventKey struct {
+	gpu  int
+	name string
+}
+
+type recoveryNotice struct {
+	reason, message string
+}
+
+func init() {
+	registerCollector("gpu_recovery", NewGPURecoveryCollector)
+}
+
+func NewGPURecoveryCollector(logger *slog.Logger) (Collector, error) {
+	c := &gpuRecoveryCollector{
+		recoveryActions: newDesc(
+			prometheus.BuildFQName(namespace, GPURecoverySubsystem, "actions_total"),
+			"Number of recovery actions, such as a GPU reset or node reboot, the driver requested since the exporter started.",
+			[]string{"hostname", "gpu_id", "action"}, nil,
+		),
+		eccEvents: newDesc(
+			prometheus.BuildFQName(namespace, GPURecoverySubsystem, "ecc_events_total"),
+			"Number of ECC events that triggered a recovery, i.e. double bit errors and DRAM page retirements or row remappings, since the exporter started.",
+			[]string{"hostname", "gpu_id", "event"}, nil,
+		),
+		unavailableErrors: newDesc(
+			prometheus.BuildFQName(namespace, GPURecoverySubsystem, "unavailable_errors_total"),
+			"Number of times the GPU became unavailable since the exporter started.",
+			[]string{"hostname", "gpu_id"}, nil,
+		),
+		driverReinits: newDesc(
+			prometheus.BuildFQName(namespace, GPURecoverySubsystem, "driver_reinitializations_total"),
+			"Number of times NVML had to be reinitialized after losing the driver, e.g. because it was reloaded.",
+			[]string{"hostname"}, nil,
+		),
+		logger:      logger,
+		actions:     make(map[recoveryEventKey]float64),
+		ecc:         make(map[recoveryEventKey]float64),
+		unavailable: make(map[int]float64),
+	}
+	return c, nil
+}
+
+// start connects to Kubernetes if events are enabled and starts listening
+// for NVML events.
+func (c *gpuRecoveryCollector) start() error {
+	if *recoveryKubernetesEvents {
+		client, err := kube.NewInClusterClient()
+		if err != nil {
+			return fmt.Errorf("kubernetes events: %w", err)
+		}
+		c.kube = client
+		c.notices = make(chan recoveryNotice, recoveryNotifyQueue)
+		c.notified = make(map[recoveryEventKey]time.Time)
+		c.repeats = make(map[recoveryEventKey]int)
+		go c.recordNotices()
+	}
+	go c.watch()
+	return nil
+}
+
+func (c *gpuRecoveryCollector) Update(ch chan<- prometheus.Metric) error {
+	hostname := nodeName
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for key, count := range c.actions {
+		ch <- prometheus.MustNewConstMetric(c.recoveryActions, prometheus.CounterValue, count, hostname, strconv.Itoa(key.gpu), key.name)
+	}
+	for key, count := range c.ecc {
+		ch <- prometheus.MustNewConstMetric(c.eccEvents, prometheus.CounterValue, count, hostname, strconv.Itoa(key.gpu), key.name)
+	}
+	for gpu, count := range c.unavailable {
+		ch <- prometheus.MustNewConstMetric(c.unavailableErrors, prometheus.CounterValue, count, hostname, strconv.Itoa(gpu))
+	}
+	ch <- prometheus.MustNewConstMetric(c.driverReinits, prometheus.CounterValue, c.reinitializations, hostname)
+	return nil
+}
+
+// watch listens for NVML events until the process exits, starting over
+// whenever NVML fails.
+func (c *gpuRecoveryCollector) watch() {
+	for {
+		err := c.listen()
+		c.logger.Debug("gpu recovery event listener stopped", "err", err)
+		time.Sleep(recoveryRetryInterval)
+	}
+}
+
+// listen registers for recovery events on every GPU and counts them until
+// NVML fails or is reset. NVML is only marked in use for one wait at a time,
+// so a reset requested by a collector waits at most recoveryEventWait. The
+// listener never resets NVML itself, it only requests a reset when NVML lost
+// the driver.
+func (c *gpuRecoveryCollector) listen() error {
+	done := useNVML()
+	set, generation, err := c.register()
+	done()
+	if err != nil {
+		return err
+	}
+
+	for {
+		done := useNVML()
+		if nvmlGeneration() != generation {
+			// The event set went away with the reset.
+			done()
+			c.lost = true
+			return errors.New("nvml was reset")
+		}
+		data, ret := set.Wait(uint32(recoveryEventWait.Milliseconds()))
+		switch ret {
+		case nvml.SUCCESS:
+			c.record(data)
+		case nvml.ERROR_TIMEOUT:
+		default:
+			set.Free()
+			nvmlLost(c.logger, ret)
+		}
+		done()
+
+		if ret != nvml.SUCCESS && ret != nvml.ERROR_TIMEOUT {
+			c.lost = true
+			return fmt.Errorf("wait for nvml events: %s", nvml.ErrorString(ret))
+		}
+	}
+}
+
+// register creates an event set receiving the recovery events of every GPU.
+// It returns the NVML generation the set belongs to. NVML must be marked in
+// use.
+func (c *gpuRecoveryCollector) register() (nvml.EventSet, int, error) {
+	if err := nvmlInit(c.logger); err != nil {
+		return nil, 0, err
+	}
+	generation := nvmlGeneration()
+
+	if c.lost {
+		c.lost = false
+		c.mtx.Lock()
+		c.reinitializations++
+		c.mtx.Unlock()
+	}
+
+	set, ret := nvml.EventSetCreate()
+	if ret != nvml.SUCCESS {
+		return nil, 0, fmt.Errorf("create nvml event set: %s", nvml.ErrorString(ret))
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		set.Free()
+		return nil, 0, wrapNVMLAvailabilityError("nvml device count", ret)
+	}
+	for i := 0; i < count; i++ {
+		device, ret := nvmlDevice(i)
+		if ret != nvml.SUCCESS {
+			if gpuSelected(i, "") {
+				c.logger.Warn("failed to get nvml device handle", "gpu_index", i, "err", nvml.ErrorString(ret))
+				markDeviceFailed(strconv.Itoa(i))
+			}
+			continue
+		}
+		if uuid, _ := device.GetUUID(); !gpuSelected(i, uuid) {
+			continue
+		}
+		supported, ret := device.GetSupportedEventTypes()
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to get supported event types", "gpu_index", i, "err", nvml.ErrorString(ret))
+			continue
+		}
+		if ret := device.RegisterEvents(supported&recoveryEventTypes, set); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to register recovery events", "gpu_index", i, "err", nvml.ErrorString(ret))
+		}
+	}
+	return set, generation, nil
+}
+
+func (c *gpuRecoveryCollector) record(data nvml.EventData) {
+	gpu, ret := data.Device.GetIndex()
+	if ret != nvml.SUCCESS {
+		c.logger.Debug("failed to get index of event device", "err", nvml.ErrorString(ret))
+		return
+	}
+	c.logger.Info("gpu recovery event", "gpu_index", gpu, "event_type", data.EventType, "event_data", data.EventData)
+
+	switch data.EventType {
+	case nvml.EventTypeXidCriticalError:
+		c.notify(gpu, "GPUXidError", fmt.Sprintf("GPU %d reported XID %d", gpu, data.EventData))
+	case nvml.EventTypeDoubleBitEccError:
+		c.notify(gpu, "GPUDoubleBitECCError", fmt.Sprintf("GPU %d reported a double bit ECC error", gpu))
+	case nvml.EventTypeDramRetirementFailure:
+		c.notify(gpu, "GPURowRemapFailure", fmt.Sprintf("GPU %d failed to retire or remap a DRAM row", gpu))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	switch data.EventType {
+	case nvml.EventTypeGpuRecoveryAction:
+		name, ok := recoveryActionNames[nvml.DeviceGpuRecoveryAction(data.EventData)]
+		if !ok {
+			name = "unknown"
+		}
+		c.actions[recoveryEventKey{gpu: gpu, name: name}]++
+	case nvml.EventTypeGpuUnavailableError:
+		c.unavailable[gpu]++
+	default:
+		if name, ok := recoveryECCEventNames[data.EventType]; ok {
+			c.ecc[recoveryEventKey{gpu: gpu, name: name}]++
+		}
+	}
+}
+
+// notify queues a Warning event on the node, if enabled. Repeats with the
+// same GPU and reason within recoveryNotifyInterval are collapsed into the
+// next event after it, and events are dropped while the queue is full, so an
+// error storm neither blocks the listener nor floods the API server.
+func (c *gpuRecoveryCollector) notify(gpu int, reason, message string) {
+	if c.kube == nil {
+		return
+	}
+	key := recoveryEventKey{gpu: gpu, name: reason}
+	now := time.Now()
+	if last, ok := c.notified[key]; ok && now.Sub(last) < recoveryNotifyInterval {
+		c.repeats[key]++
+		return
+	}
+	if n := c.repeats[key]; n > 0 {
+		message = fmt.Sprintf("%s, repeated %d times since the previous event", message, n)
+	}
+	select {
+	case c.notices <- recoveryNotice{reason: reason, message: message}:
+		c.notified[key] = now
+		delete(c.repeats, key)
+	default:
+		c.repeats[key]++
+		c.logger.Debug("kubernetes event queue full, collapsing event", "reason", reason, "gpu_index", gpu)
+	}
+}
+
+// recordNotices records the queued Kubernetes events one at a time for the
+// lifetime of the exporter.
+func (c *gpuRecoveryCollector) recordNotices() {
+	for notice := range c.notices {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := c.kube.NodeWarning(ctx, nodeName, notice.reason, notice.message); err != nil {
+			c.logger.Warn("failed to record kubernetes event", "reason", notice.reason, "err", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+// reloader is implemented by collectors that read configuration files.
+type reloader interface {
+	// reload reads the configuration files again, keeping the previous
+	// configuration if they are invalid.
+	reload() error
+}
+
+// Overrides are the collector settings of a configuration file, which take
+// precedence over the command line. Settings the file leaves out keep their
+// command-line values. A nil Overrides overrides nothing.
+type Overrides struct {
+	collectors    map[string]*bool
+	collectorsSet map[string]*bool
+
+	gpuInclude, gpuExclude       []string
+	gpuIncludeSet, gpuExcludeSet bool
+}
+
+// OverrideFlags defines the flags of the collector settings a configuration
+// file may set on app: --[no-]collector.<name>, --collector.gpu.include and
+// --collector.gpu.exclude. Parsing app fills in the returned Overrides.
+func OverrideFlags(app *kingpin.Application) *Overrides {
+	o := &Overrides{
+		collectors:    make(map[string]*bool, len(factories)),
+		collectorsSet: make(map[string]*bool, len(factories)),
+	}
+	for name := range factories {
+		set := new(bool)
+		o.collectors[name] = app.Flag("collector."+name, "").IsSetByUser(set).Bool()
+		o.collectorsSet[name] = set
+	}
+	app.Flag("collector.gpu.include", "").IsSetByUser(&o.gpuIncludeSet).StringsVar(&o.gpuInclude)
+	app.Flag("collector.gpu.exclude", "").IsSetByUser(&o.gpuExcludeSet).StringsVar(&o.gpuExclude)
+	return o
+}
+
+// Check validates the settings of o without applying them.
+func (o *Overrides) Check() error {
+	return o.gpuFilter().check()
+}
+
+// enabled reports whether the collector name runs, given whether it is
+// enabled on the command line.
+func (o *Overrides) enabled(name string, cmdline bool) bool {
+	if o == nil || o.collectorsSet[name] == nil || !*o.collectorsSet[name] {
+		return cmdline
+	}
+	return *o.collectors[name]
+}
+
+func (o *Overrides) gpuFilter() gpuFilter {
+	f := gpuFilter{include: *gpuInclude, exclude: *gpuExclude}
+	if o == nil {
+		return f
+	}
+	if o.gpuIncludeSet {
+		f.include = o.gpuInclude
+	}
+	if o.gpuExcludeSet {
+		f.exclude = o.gpuExclude
+	}
+	return f
+}
+
+// Reload applies o on top of the command line: it starts and stops
+// collectors, changes the GPU filter and makes the collectors read their
+// configuration files again, such as --collector.dcgm_fields.config. Nothing
+// is applied if o is invalid or a collector can't be started, and a collector
+// whose configuration file is invalid keeps its previous configuration.
+// Other flags only take effect on restart.
+func (n *NvidiaGPUCollector) Reload(o *Overrides) error {
+	filter := o.gpuFilter()
+	if err := filter.check(); err != nil {
+		return err
+	}
+	collectors, err := n.enabledCollectors(o)
+	if err != nil {
+		return err
+	}
+	reloadedGPUFilter.Store(&filter)
+	n.mtx.Lock()
+	n.collectors = collectors
+	n.mtx.Unlock()
+
+	var errs []error
+	for name, c := range collectors {
+		if cached, ok := c.(*cachedCollector); ok {
+			c = cached.Collector
+		}
+		if r, ok := c.(reloader); ok {
+			if err := r.reload(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
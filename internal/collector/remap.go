@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"log/slog"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPURowRemapSubsystem = "row_remap"
+)
+
+var gpuRowRemapFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS,
+	dcgm.DCGM_FI_DEV_UNCORRECTABLE_REMAPPED_ROWS,
+	dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING,
+	dcgm.DCGM_FI_DEV_ROW_REMAP_FAILURE,
+}
+
+// gpuRowRemapCollector exports the row remapping state of Ampere and newer
+// GPUs, which replaces page retirement on those architectures.
+type gpuRowRemapCollector struct {
+	remappedRows *prometheus.Desc
+	pending      *prometheus.Desc
+	failure      *prometheus.Desc
+	logger       *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_row_remap", NewGPURowRemapCollector)
+}
+
+func NewGPURowRemapCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuRowRemapCollector{
+		remappedRows: newDesc(
+			prometheus.BuildFQName(namespace, GPURowRemapSubsystem, "remapped_rows"),
+			"Number of GPU memory rows remapped due to correctable or uncorrectable errors.",
+			[]string{"hostname", "gpu_id", "gpu_name", "error_type"}, nil,
+		),
+		pending: newDesc(
+			prometheus.BuildFQName(namespace, GPURowRemapSubsystem, "pending"),
+			"Whether a row remapping is pending and requires a GPU reset.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		failure: newDesc(
+			prometheus.BuildFQName(namespace, GPURowRemapSubsystem, "failure"),
+			"Whether a row remapping has failed.",
+			[]string{"hostname", "gpu_id", "gpu_name"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuRowRemapCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectDCGMGPUs(c.logger, gpuRowRemapFields, func(gpu dcgmGPU) {
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_CORRECTABLE_REMAPPED_ROWS]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.remappedRows, prometheus.GaugeValue, float64(val.Int64()), withLabels(gpu.labels, "correctable")...), val)
+		}
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_UNCORRECTABLE_REMAPPED_ROWS]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.remappedRows, prometheus.GaugeValue, float64(val.Int64()), withLabels(gpu.labels, "uncorrectable")...), val)
+		}
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_ROW_REMAP_PENDING]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, boolToFloat(val.Int64() != 0), gpu.labels...), val)
+		}
+		if val, ok := gpu.values[dcgm.DCGM_FI_DEV_ROW_REMAP_FAILURE]; ok {
+			ch <- withFieldTimestamp(prometheus.MustNewConstMetric(c.failure, prometheus.GaugeValue, boolToFloat(val.Int64() != 0), gpu.labels...), val)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var snapshotTimestampDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "scrape", "snapshot_timestamp_seconds"),
+	"Unix time the served metrics were collected at by the background poller.",
+	nil, nil,
+)
+
+// SnapshotCollector collects the metrics of a collector in the background
+// and serves the latest snapshot, so scrapes return instantly however long
+// DCGM and NVML take.
+type SnapshotCollector struct {
+	collector prometheus.Collector
+	logger    *slog.Logger
+
+	mtx      sync.RWMutex
+	metrics  []prometheus.Metric
+	taken    time.Time
+	hasTaken chan struct{}
+}
+
+func NewSnapshotCollector(collector prometheus.Collector, logger *slog.Logger) *SnapshotCollector {
+	return &SnapshotCollector{
+		collector: collector,
+		logger:    logger,
+		hasTaken:  make(chan struct{}),
+	}
+}
+
+// Run takes a snapshot every interval until ctx is done.
+func (s *SnapshotCollector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.take()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SnapshotCollector) take() {
+	begin := time.Now()
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		close(done)
+	}()
+	s.collector.Collect(ch)
+	close(ch)
+	<-done
+	s.logger.Debug("took metrics snapshot", "metrics", len(metrics), "duration_seconds", time.Since(begin).Seconds())
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	first := s.taken.IsZero()
+	s.metrics, s.taken = metrics, begin
+	if first {
+		close(s.hasTaken)
+	}
+}
+
+func (s *SnapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+	ch <- snapshotTimestampDesc
+}
+
+func (s *SnapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	s.CollectContext(context.Background(), ch)
+}
+
+// CollectContext serves the latest snapshot. Scrapes before the first
+// snapshot wait for it until ctx is done, and return nothing if it isn't
+// ready by then.
+func (s *SnapshotCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	select {
+	case <-s.hasTaken:
+	case <-ctx.Done():
+		s.logger.Debug("no metrics snapshot before scrape timeout", "err", ctx.Err())
+		return
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, metric := range s.metrics {
+		ch <- metric
+	}
+	ch <- prometheus.MustNewConstMetric(snapshotTimestampDesc, prometheus.GaugeValue, float64(s.taken.UnixNano())/1e9)
+}
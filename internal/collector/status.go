@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gpusEnumerated is set once any collector has successfully listed the GPUs
+// of the node.
+var gpusEnumerated atomic.Bool
+
+func markEnumerated() {
+	gpusEnumerated.Store(true)
+}
+
+// collectionStatus tracks the outcome of recent collections.
+type collectionStatus struct {
+	consecutiveSuccesses atomic.Int64
+	lastErrors           lastErrors
+}
+
+func (s *collectionStatus) observe(success bool) {
+	if success {
+		s.consecutiveSuccesses.Add(1)
+	} else {
+		s.consecutiveSuccesses.Store(0)
+	}
+}
+
+// Enumerated reports whether the GPUs of the node have been listed
+// successfully at least once.
+func (n *NvidiaGPUCollector) Enumerated() bool {
+	return gpusEnumerated.Load()
+}
+
+// ConsecutiveSuccesses returns the number of collections in a row in which
+// every collector succeeded.
+func (n *NvidiaGPUCollector) ConsecutiveSuccesses() int64 {
+	return n.status.consecutiveSuccesses.Load()
+}
+
+var deviceSuccessDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "scrape", "device_success"),
+	"Whether every collector could query the GPU during the collection. GPUs that can't be queried are left out of the other metrics.",
+	[]string{"gpu_id"},
+	nil,
+)
+
+// deviceStatus tracks when collectors last saw each GPU and last failed to
+// query it, by gpu_id label value.
+var deviceStatus struct {
+	mtx    sync.Mutex
+	seen   map[string]time.Time
+	failed map[string]time.Time
+}
+
+// markDeviceSeen records that gpuID was enumerated.
+func markDeviceSeen(gpuID string) {
+	deviceStatus.mtx.Lock()
+	defer deviceStatus.mtx.Unlock()
+	if deviceStatus.seen == nil {
+		deviceStatus.seen = make(map[string]time.Time)
+	}
+	deviceStatus.seen[gpuID] = time.Now()
+}
+
+// markDeviceFailed records that gpuID was enumerated but couldn't be queried,
+// so it is left out of a collector's metrics.
+func markDeviceFailed(gpuID string) {
+	deviceStatus.mtx.Lock()
+	defer deviceStatus.mtx.Unlock()
+	if deviceStatus.failed == nil {
+		deviceStatus.failed = make(map[string]time.Time)
+	}
+	now := time.Now()
+	if deviceStatus.seen == nil {
+		deviceStatus.seen = make(map[string]time.Time)
+	}
+	deviceStatus.seen[gpuID] = now
+	deviceStatus.failed[gpuID] = now
+}
+
+// collectDeviceStatus exports whether the GPUs seen since begin were queried
+// successfully since then.
+func collectDeviceStatus(ch chan<- prometheus.Metric, begin time.Time) {
+	deviceStatus.mtx.Lock()
+	defer deviceStatus.mtx.Unlock()
+	for gpuID, seen := range deviceStatus.seen {
+		if seen.Before(begin) {
+			continue
+		}
+		failed := !deviceStatus.failed[gpuID].Before(begin)
+		ch <- prometheus.MustNewConstMetric(deviceSuccessDesc, prometheus.GaugeValue, boolToFloat(!failed), gpuID)
+	}
+}
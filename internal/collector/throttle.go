@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"errors"
+	"log/slog"
+
+	dcgm "github.com/NVIDIA/go-dcgm/pkg/dcgm"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUThrottleSubsystem = "throttle"
+)
+
+var gpuThrottleReasons = []struct {
+	name string
+	mask uint64
+}{
+	{"gpu_idle", nvml.ClocksEventReasonGpuIdle},
+	{"applications_clocks_setting", nvml.ClocksEventReasonApplicationsClocksSetting},
+	{"sw_power_cap", nvml.ClocksEventReasonSwPowerCap},
+	{"hw_slowdown", nvml.ClocksThrottleReasonHwSlowdown},
+	{"sync_boost", nvml.ClocksEventReasonSyncBoost},
+	{"sw_thermal_slowdown", nvml.ClocksEventReasonSwThermalSlowdown},
+	{"hw_thermal_slowdown", nvml.ClocksThrottleReasonHwThermalSlowdown},
+	{"hw_power_brake_slowdown", nvml.ClocksThrottleReasonHwPowerBrakeSlowdown},
+	{"display_clock_setting", nvml.ClocksEventReasonDisplayClockSetting},
+}
+
+var gpuViolations = []struct {
+	name  string
+	field dcgm.Short
+}{
+	{"power", dcgm.DCGM_FI_DEV_POWER_VIOLATION},
+	{"thermal", dcgm.DCGM_FI_DEV_THERMAL_VIOLATION},
+	{"board_limit", dcgm.DCGM_FI_DEV_BOARD_LIMIT_VIOLATION},
+	{"sync_boost", dcgm.DCGM_FI_DEV_SYNC_BOOST_VIOLATION},
+}
+
+var gpuHWSlowdowns = []struct {
+	name  string
+	field uint32
+}{
+	{"thermal", nvml.FI_DEV_CLOCKS_EVENT_REASON_HW_THERM_SLOWDOWN},
+	{"power_brake", nvml.FI_DEV_CLOCKS_EVENT_REASON_HW_POWER_BRAKE_SLOWDOWN},
+}
+
+var gpuViolationFields = []dcgm.Short{
+	dcgm.DCGM_FI_DEV_POWER_VIOLATION,
+	dcgm.DCGM_FI_DEV_THERMAL_VIOLATION,
+	dcgm.DCGM_FI_DEV_BOARD_LIMIT_VIOLATION,
+	dcgm.DCGM_FI_DEV_SYNC_BOOST_VIOLATION,
+}
+
+// gpuThrottleCollector exports why the clocks of each GPU are currently
+// reduced, decoded from the NVML clocks event reasons bitmask, and how long
+// each GPU has been throttled in total.
+type gpuThrottleCollector struct {
+	reasons    *prometheus.Desc
+	violations typedDesc
+	hwSlowdown typedDesc
+	logger     *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_throttle", NewGPUThrottleCollector)
+}
+
+func NewGPUThrottleCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuThrottleCollector{
+		reasons: newDesc(
+			prometheus.BuildFQName(namespace, GPUThrottleSubsystem, "reasons"),
+			"Whether the GPU clocks are currently reduced for the given reason.",
+			[]string{"hostname", "gpu_id", "gpu_name", "reason"}, nil,
+		),
+		violations: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, GPUThrottleSubsystem, "violation_seconds_total"),
+			"Total time the GPU clocks were reduced because of the given violation.",
+			[]string{"hostname", "gpu_id", "gpu_name", "violation"}, nil,
+		), prometheus.CounterValue},
+		hwSlowdown: typedDesc{newDesc(
+			prometheus.BuildFQName(namespace, GPUThrottleSubsystem, "hw_slowdown_seconds_total"),
+			"Total time the hardware halved the GPU clocks or more, either because the GPU overheated (thermal) or an external power brake was asserted (power_brake). Both point at cooling or PSU problems rather than software power capping.",
+			[]string{"hostname", "gpu_id", "gpu_name", "slowdown"}, nil,
+		), prometheus.CounterValue},
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuThrottleCollector) Update(ch chan<- prometheus.Metric) error {
+	return errors.Join(c.updateReasons(ch), c.updateViolations(ch))
+}
+
+func (c *gpuThrottleCollector) updateReasons(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if idleSuppressed(gpu.uuid) {
+			return
+		}
+		current, ret := gpu.device.GetCurrentClocksEventReasons()
+		if ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+			// Drivers older than R535 only provide the deprecated API.
+			current, ret = gpu.device.GetCurrentClocksThrottleReasons()
+		}
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read clocks event reasons", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+
+		supported, ret := gpu.device.GetSupportedClocksEventReasons()
+		if ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+			supported, ret = gpu.device.GetSupportedClocksThrottleReasons()
+		}
+		if ret != nvml.SUCCESS {
+			supported = nvml.ClocksEventReasonAll
+		}
+
+		for _, reason := range gpuThrottleReasons {
+			if supported&reason.mask == 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				c.reasons,
+				prometheus.GaugeValue,
+				boolToFloat(current&reason.mask != 0),
+				withLabels(gpu.labels, reason.name)...,
+			)
+		}
+
+		values := make([]nvml.FieldValue, len(gpuHWSlowdowns))
+		for i, slowdown := range gpuHWSlowdowns {
+			values[i].FieldId = slowdown.field
+		}
+		if ret := gpu.device.GetFieldValues(values); ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read hw slowdown durations", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+		for i, slowdown := range gpuHWSlowdowns {
+			if ns, ok := nvmlFieldValueFloat64(values[i]); ok {
+				ch <- c.hwSlowdown.mustNewConstMetric(ns/1e9, withLabels(gpu.labels, slowdown.name)...)
+			}
+		}
+	})
+}
+
+func (c *gpuThrottleCollector) updateViolations(ch chan<- prometheus.Metric) error {
+	return collectDCGMGPUs(c.logger, gpuViolationFields, func(gpu dcgmGPU) {
+		if idleSuppressed(gpu.info.UUID) {
+			return
+		}
+		for _, violation := range gpuViolations {
+			if val, ok := gpu.values[violation.field]; ok {
+				ch <- withFieldTimestamp(c.violations.mustNewConstMetric(
+					microsecondsToSeconds(val.Int64()),
+					withLabels(gpu.labels, violation.name)...,
+				), val)
+			}
+		}
+	})
+}
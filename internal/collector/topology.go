@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	GPUTopologySubsystem = "topology"
+)
+
+// topologyLevelNames maps NVML topology levels to the abbreviations used by
+// `nvidia-smi topo -m`.
+var topologyLevelNames = map[nvml.GpuTopologyLevel]string{
+	nvml.TOPOLOGY_INTERNAL:   "X",
+	nvml.TOPOLOGY_SINGLE:     "PIX",
+	nvml.TOPOLOGY_MULTIPLE:   "PXB",
+	nvml.TOPOLOGY_HOSTBRIDGE: "PHB",
+	nvml.TOPOLOGY_NODE:       "NODE",
+	nvml.TOPOLOGY_SYSTEM:     "SYS",
+}
+
+// gpuTopologyCollector exports how every pair of GPUs is connected, the way
+// `nvidia-smi topo -m` shows it.
+type gpuTopologyCollector struct {
+	link   *prometheus.Desc
+	logger *slog.Logger
+}
+
+func init() {
+	registerCollector("gpu_topology", NewGPUTopologyCollector)
+}
+
+func NewGPUTopologyCollector(logger *slog.Logger) (Collector, error) {
+	return &gpuTopologyCollector{
+		link: newDesc(
+			prometheus.BuildFQName(namespace, GPUTopologySubsystem, "link_info"),
+			"Connection between two GPUs: NV<n> for n bonded NVLinks, otherwise the closest common PCIe ancestor (PIX, PXB, PHB, NODE or SYS).",
+			[]string{"hostname", "gpu_id", "peer_gpu_id", "link_type"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *gpuTopologyCollector) Update(ch chan<- prometheus.Metric) error {
+	// The pairwise queries below use the handles of all GPUs, so NVML is
+	// held for the whole update rather than per GPU.
+	release := lockNVML()
+	defer release()
+	gpus, err := gpuBackend.nvmlGPUs(c.logger)
+	if err != nil {
+		return err
+	}
+
+	busIDs := make(map[string]int, len(gpus))
+	for _, gpu := range gpus {
+		if pci, ret := gpu.device.GetPciInfo(); ret == nvml.SUCCESS {
+			busIDs[normalizeBusID(cString(pci.BusId[:]))] = gpu.index
+		}
+	}
+
+	for _, gpu := range gpus {
+		nvlinks := nvlinkPeers(gpu.device, busIDs)
+		for _, peer := range gpus {
+			if peer.index == gpu.index {
+				continue
+			}
+			linkType := ""
+			if n := nvlinks[peer.index]; n > 0 {
+				linkType = fmt.Sprintf("NV%d", n)
+			} else {
+				level, ret := gpu.device.GetTopologyCommonAncestor(peer.device)
+				if ret != nvml.SUCCESS {
+					c.logger.Debug("failed to read gpu topology", "gpu_index", gpu.index, "peer_gpu_index", peer.index, "err", nvml.ErrorString(ret))
+					continue
+				}
+				name, ok := topologyLevelNames[level]
+				if !ok {
+					name = "unknown"
+				}
+				linkType = name
+			}
+			// gpu.labels[:2] holds the hostname and gpu_id.
+			ch <- prometheus.MustNewConstMetric(c.link, prometheus.GaugeValue, 1, withLabels(gpu.labels[:2], peer.labels[1], linkType)...)
+		}
+	}
+
+	return nil
+}
+
+// nvlinkPeers returns the number of active NVLinks from device to each peer
+// GPU, keyed by the peer's index.
+func nvlinkPeers(device nvml.Device, busIDs map[string]int) map[int]int {
+	peers := make(map[int]int)
+	for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+		state, ret := device.GetNvLinkState(link)
+		if ret != nvml.SUCCESS || state != nvml.FEATURE_ENABLED {
+			continue
+		}
+		remote, ret := device.GetNvLinkRemotePciInfo(link)
+		if ret != nvml.SUCCESS {
+			continue
+		}
+		if peer, ok := busIDs[normalizeBusID(cString(remote.BusId[:]))]; ok {
+			peers[peer]++
+		}
+	}
+	return peers
+}
+
+// normalizeBusID makes PCI bus IDs comparable, as NVML reports them with
+// either a 4 or 8 digit domain depending on the call.
+func normalizeBusID(busID string) string {
+	busID = strings.ToLower(busID)
+	if domain, rest, ok := strings.Cut(busID, ":"); ok && len(domain) > 4 {
+		return domain[len(domain)-4:] + ":" + rest
+	}
+	return busID
+}
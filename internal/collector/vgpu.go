@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	VGPUSubsystem = "vgpu"
+)
+
+// vgpuLicenseCollector exports the licensing state of vGPU/GRID guests.
+// Unlicensed guests silently fall back to reduced performance, so the state
+// is worth alerting on.
+type vgpuLicenseCollector struct {
+	licensed      *prometheus.Desc
+	licenseExpiry *prometheus.Desc
+	logger        *slog.Logger
+}
+
+func init() {
+	registerCollector("vgpu_license", NewVGPULicenseCollector)
+}
+
+func NewVGPULicenseCollector(logger *slog.Logger) (Collector, error) {
+	return &vgpuLicenseCollector{
+		licensed: newDesc(
+			prometheus.BuildFQName(namespace, VGPUSubsystem, "licensed"),
+			"Whether the licensable feature is currently licensed.",
+			[]string{"hostname", "gpu_id", "gpu_name", "feature", "product"}, nil,
+		),
+		licenseExpiry: newDesc(
+			prometheus.BuildFQName(namespace, VGPUSubsystem, "license_expiry_timestamp_seconds"),
+			"Unix timestamp at which the license of the feature expires. Absent for permanent licenses.",
+			[]string{"hostname", "gpu_id", "gpu_name", "feature", "product"}, nil,
+		),
+		logger: logger,
+	}, nil
+}
+
+func (c *vgpuLicenseCollector) Update(ch chan<- prometheus.Metric) error {
+	return collectNVMLGPUsConcurrently(c.logger, func(gpu nvmlGPU) {
+		if idleSuppressed(gpu.uuid) {
+			return
+		}
+		features, ret := gpu.device.GetGridLicensableFeatures()
+		if ret != nvml.SUCCESS {
+			c.logger.Debug("failed to read grid licensable features", "gpu_index", gpu.index, "err", nvml.ErrorString(ret))
+			return
+		}
+		if features.IsGridLicenseSupported == 0 {
+			return
+		}
+
+		count := min(int(features.LicensableFeaturesCount), len(features.GridLicensableFeatures))
+		for _, feature := range features.GridLicensableFeatures[:count] {
+			labels := withLabels(gpu.labels,
+				gridFeatureName(nvml.GridLicenseFeatureCode(feature.FeatureCode)),
+				cString(feature.ProductName[:]),
+			)
+			ch <- prometheus.MustNewConstMetric(c.licensed, prometheus.GaugeValue, boolToFloat(feature.FeatureState != 0), labels...)
+
+			if expiry := feature.LicenseExpiry; expiry.Status == nvml.GRID_LICENSE_EXPIRY_VALID {
+				t := time.Date(int(expiry.Year), time.Month(expiry.Month), int(expiry.Day),
+					int(expiry.Hour), int(expiry.Min), int(expiry.Sec), 0, time.UTC)
+				ch <- prometheus.MustNewConstMetric(c.licenseExpiry, prometheus.GaugeValue, float64(t.Unix()), labels...)
+			}
+		}
+	})
+}
+
+func gridFeatureName(code nvml.GridLicenseFeatureCode) string {
+	switch code {
+	case nvml.GRID_LICENSE_FEATURE_CODE_VGPU:
+		return "vgpu"
+	case nvml.GRID_LICENSE_FEATURE_CODE_NVIDIA_RTX:
+		return "nvidia_rtx"
+	case nvml.GRID_LICENSE_FEATURE_CODE_GAMING:
+		return "gaming"
+	case nvml.GRID_LICENSE_FEATURE_CODE_COMPUTE:
+		return "compute"
+	}
+	return "unknown"
+}
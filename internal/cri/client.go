@@ -0,0 +1,126 @@
+// Package cri queries the container runtime of the node, such as containerd
+// or CRI-O, through the Kubernetes Container Runtime Interface.
+package cri
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/unixgrpc"
+)
+
+// DefaultSocket is where containerd serves the CRI API.
+const DefaultSocket = "/run/containerd/containerd.sock"
+
+// Field numbers of the runtime.v1 messages the exporter reads.
+const (
+	// ListContainersResponse
+	fieldContainers = 1
+	// Container
+	fieldContainerID       = 1
+	fieldContainerMetadata = 3
+	fieldContainerImage    = 4
+	fieldContainerLabels   = 8
+	// ContainerMetadata
+	fieldMetadataName = 1
+	// ImageSpec
+	fieldImageSpecImage = 1
+	// map<string, string> entries
+	fieldMapKey   = 1
+	fieldMapValue = 2
+)
+
+// Labels the kubelet sets on the containers of pods.
+const (
+	labelPodNamespace = "io.kubernetes.pod.namespace"
+	labelPodName      = "io.kubernetes.pod.name"
+)
+
+// Container is a container known to the runtime.
+type Container struct {
+	Name  string
+	Image string
+	// Namespace and Pod identify the pod of the container, empty for
+	// containers the kubelet didn't start.
+	Namespace string
+	Pod       string
+}
+
+// Client queries the CRI runtime service.
+type Client struct {
+	grpc *unixgrpc.Client
+}
+
+// NewClient returns a client for the CRI runtime service served on socket.
+func NewClient(socket string) *Client {
+	return &Client{grpc: unixgrpc.NewClient(socket)}
+}
+
+// Containers returns the containers known to the runtime, keyed by container
+// ID.
+func (c *Client) Containers(ctx context.Context) (map[string]Container, error) {
+	// An empty ListContainersRequest lists containers in every state.
+	message, err := c.grpc.Invoke(ctx, "/runtime.v1.RuntimeService/ListContainers", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeListContainersResponse(message)
+}
+
+func decodeListContainersResponse(message []byte) (map[string]Container, error) {
+	containers := make(map[string]Container)
+	err := unixgrpc.ForEachField(message, func(num protowire.Number, value []byte) error {
+		if num != fieldContainers {
+			return nil
+		}
+		var (
+			id        string
+			container Container
+		)
+		err := unixgrpc.ForEachField(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case fieldContainerID:
+				id = string(value)
+			case fieldContainerMetadata:
+				return unixgrpc.ForEachField(value, func(num protowire.Number, value []byte) error {
+					if num == fieldMetadataName {
+						container.Name = string(value)
+					}
+					return nil
+				})
+			case fieldContainerImage:
+				return unixgrpc.ForEachField(value, func(num protowire.Number, value []byte) error {
+					if num == fieldImageSpecImage {
+						container.Image = string(value)
+					}
+					return nil
+				})
+			case fieldContainerLabels:
+				var key, label string
+				err := unixgrpc.ForEachField(value, func(num protowire.Number, value []byte) error {
+					switch num {
+					case fieldMapKey:
+						key = string(value)
+					case fieldMapValue:
+						label = string(value)
+					}
+					return nil
+				})
+				switch key {
+				case labelPodNamespace:
+					container.Namespace = label
+				case labelPodName:
+					container.Pod = label
+				}
+				return err
+			}
+			return nil
+		})
+		if id != "" {
+			containers[id] = container
+		}
+		return err
+	})
+	return containers, err
+}
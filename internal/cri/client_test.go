@@ -0,0 +1,82 @@
+package cri
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func appendLabel(b []byte, key, value string) []byte {
+	var entry []byte
+	entry = appendString(entry, fieldMapKey, key)
+	entry = appendString(entry, fieldMapValue, value)
+	return appendMessage(b, fieldContainerLabels, entry)
+}
+
+func TestDecodeListContainersResponse(t *testing.T) {
+	var metadata, image []byte
+	metadata = appendString(metadata, fieldMetadataName, "trainer")
+	image = appendString(image, fieldImageSpecImage, "nvcr.io/nvidia/pytorch:24.01")
+
+	var pod []byte
+	pod = appendString(pod, fieldContainerID, "abc")
+	pod = appendMessage(pod, fieldContainerMetadata, metadata)
+	pod = appendMessage(pod, fieldContainerImage, image)
+	// The state is a varint, which is skipped.
+	pod = protowire.AppendTag(pod, 6, protowire.VarintType)
+	pod = protowire.AppendVarint(pod, 1)
+	pod = appendLabel(pod, "io.kubernetes.pod.namespace", "ml")
+	pod = appendLabel(pod, "io.kubernetes.container.name", "trainer")
+	pod = appendLabel(pod, "io.kubernetes.pod.name", "train-0")
+
+	var plain []byte
+	plain = appendString(plain, fieldContainerID, "def")
+	plain = appendLabel(plain, "app", "web")
+
+	var noID []byte
+	noID = appendMessage(noID, fieldContainerMetadata, metadata)
+
+	var response []byte
+	response = appendMessage(response, fieldContainers, pod)
+	response = appendMessage(response, fieldContainers, plain)
+	response = appendMessage(response, fieldContainers, noID)
+
+	for _, tc := range []struct {
+		name    string
+		message []byte
+		want    map[string]Container
+		wantErr bool
+	}{
+		{
+			name:    "containers",
+			message: response,
+			want: map[string]Container{
+				"abc": {Name: "trainer", Image: "nvcr.io/nvidia/pytorch:24.01", Namespace: "ml", Pod: "train-0"},
+				"def": {},
+			},
+		},
+		{name: "empty", message: nil, want: map[string]Container{}},
+		{name: "truncated", message: response[:len(response)-2], wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeListContainersResponse(tc.message)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("decodeListContainersResponse() error = %v, want error %t", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("decodeListContainersResponse() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Package docker lists containers through the Docker Engine API, for nodes
+// where the container runtime doesn't serve the CRI API.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where the Docker daemon serves its API.
+const DefaultSocket = "/var/run/docker.sock"
+
+// Container is a container known to the Docker daemon.
+type Container struct {
+	Name  string
+	Image string
+	// Namespace and Pod identify the pod of the container, set with
+	// cri-dockerd only.
+	Namespace string
+	Pod       string
+}
+
+// Client queries the Docker Engine API.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the Docker daemon listening on socket.
+func NewClient(socket string) *Client {
+	return &Client{
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Containers returns the running containers, keyed by container ID.
+func (c *Client) Containers(ctx context.Context) (map[string]Container, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("GET /containers/json: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var list []struct {
+		ID     string            `json:"Id"`
+		Names  []string          `json:"Names"`
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decode containers: %w", err)
+	}
+
+	containers := make(map[string]Container, len(list))
+	for _, container := range list {
+		var name string
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		containers[container.ID] = Container{
+			Name:      name,
+			Image:     container.Image,
+			Namespace: container.Labels["io.kubernetes.pod.namespace"],
+			Pod:       container.Labels["io.kubernetes.pod.name"],
+		}
+	}
+	return containers, nil
+}
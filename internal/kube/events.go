@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"time"
+)
+
+const eventComponent = "nvidia-gpu-exporter"
+
+// event is the subset of a core/v1 Event the exporter sets.
+type event struct {
+	APIVersion         string        `json:"apiVersion"`
+	Kind               string        `json:"kind"`
+	Metadata           eventMetadata `json:"metadata"`
+	InvolvedObject     objectRef     `json:"involvedObject"`
+	Reason             string        `json:"reason"`
+	Message            string        `json:"message"`
+	Type               string        `json:"type"`
+	Source             eventSource   `json:"source"`
+	FirstTimestamp     time.Time     `json:"firstTimestamp"`
+	LastTimestamp      time.Time     `json:"lastTimestamp"`
+	Count              int           `json:"count"`
+	ReportingComponent string        `json:"reportingComponent"`
+	ReportingInstance  string        `json:"reportingInstance"`
+}
+
+type eventMetadata struct {
+	GenerateName string `json:"generateName"`
+	Namespace    string `json:"namespace"`
+}
+
+type objectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+type eventSource struct {
+	Component string `json:"component"`
+	Host      string `json:"host"`
+}
+
+// NodeWarning records a Warning event on node, so it shows up in
+// `kubectl describe node`.
+func (c *Client) NodeWarning(ctx context.Context, node, reason, message string) error {
+	now := time.Now().UTC()
+	return c.post(ctx, "/api/v1/namespaces/default/events", event{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata:   eventMetadata{GenerateName: node + ".", Namespace: "default"},
+		// The kubelet uses the node name as UID for node events, which is
+		// what kubectl matches on.
+		InvolvedObject:     objectRef{APIVersion: "v1", Kind: "Node", Name: node, UID: node},
+		Reason:             reason,
+		Message:            message,
+		Type:               "Warning",
+		Source:             eventSource{Component: eventComponent, Host: node},
+		FirstTimestamp:     now,
+		LastTimestamp:      now,
+		Count:              1,
+		ReportingComponent: eventComponent,
+		ReportingInstance:  node,
+	})
+}
@@ -0,0 +1,41 @@
+// Package podresources lists the devices the kubelet allocated to pods,
+// using the kubelet's pod-resources API.
+package podresources
+
+import (
+	"context"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/unixgrpc"
+)
+
+// DefaultSocket is where the kubelet serves the pod-resources API.
+const DefaultSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+// Allocation is a device allocated to a container.
+type Allocation struct {
+	Namespace string
+	Pod       string
+	Container string
+	Resource  string
+	DeviceID  string
+}
+
+// Client queries the pod-resources API of the local kubelet.
+type Client struct {
+	grpc *unixgrpc.Client
+}
+
+// NewClient returns a client for the pod-resources API served on socket.
+func NewClient(socket string) *Client {
+	return &Client{grpc: unixgrpc.NewClient(socket)}
+}
+
+// List returns the devices currently allocated to containers.
+func (c *Client) List(ctx context.Context) ([]Allocation, error) {
+	// ListPodResourcesRequest has no fields.
+	message, err := c.grpc.Invoke(ctx, "/v1.PodResourcesLister/List", nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeListResponse(message)
+}
@@ -0,0 +1,106 @@
+package podresources
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/V01d42/nvidia-gpu-exporter/internal/unixgrpc"
+)
+
+// Field numbers of the v1 pod-resources messages the exporter reads.
+const (
+	// ListPodResourcesResponse
+	fieldPodResources = 1
+	// PodResources
+	fieldPodName       = 1
+	fieldPodNamespace  = 2
+	fieldPodContainers = 3
+	// ContainerResources
+	fieldContainerName    = 1
+	fieldContainerDevices = 2
+	// ContainerDevices
+	fieldResourceName = 1
+	fieldDeviceIDs    = 2
+)
+
+func decodeListResponse(b []byte) ([]Allocation, error) {
+	var allocations []Allocation
+	err := unixgrpc.ForEachField(b, func(num protowire.Number, value []byte) error {
+		if num != fieldPodResources {
+			return nil
+		}
+		pod, err := decodePod(value)
+		allocations = append(allocations, pod...)
+		return err
+	})
+	return allocations, err
+}
+
+func decodePod(b []byte) ([]Allocation, error) {
+	var (
+		name, namespace string
+		containers      [][]byte
+	)
+	err := unixgrpc.ForEachField(b, func(num protowire.Number, value []byte) error {
+		switch num {
+		case fieldPodName:
+			name = string(value)
+		case fieldPodNamespace:
+			namespace = string(value)
+		case fieldPodContainers:
+			containers = append(containers, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var allocations []Allocation
+	for _, container := range containers {
+		var (
+			containerName string
+			devices       [][]byte
+		)
+		err := unixgrpc.ForEachField(container, func(num protowire.Number, value []byte) error {
+			switch num {
+			case fieldContainerName:
+				containerName = string(value)
+			case fieldContainerDevices:
+				devices = append(devices, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, device := range devices {
+			var (
+				resource string
+				ids      []string
+			)
+			err := unixgrpc.ForEachField(device, func(num protowire.Number, value []byte) error {
+				switch num {
+				case fieldResourceName:
+					resource = string(value)
+				case fieldDeviceIDs:
+					ids = append(ids, string(value))
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				allocations = append(allocations, Allocation{
+					Namespace: namespace,
+					Pod:       name,
+					Container: containerName,
+					Resource:  resource,
+					DeviceID:  id,
+				})
+			}
+		}
+	}
+	return allocations, nil
+}
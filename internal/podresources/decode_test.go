@@ -0,0 +1,81 @@
+package podresources
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+func TestDecodeListResponse(t *testing.T) {
+	var devices []byte
+	devices = appendString(devices, fieldResourceName, "nvidia.com/gpu")
+	devices = appendString(devices, fieldDeviceIDs, "GPU-a")
+	devices = appendString(devices, fieldDeviceIDs, "GPU-b::1")
+	var cpus []byte
+	cpus = appendString(cpus, fieldResourceName, "example.com/fpga")
+	cpus = appendString(cpus, fieldDeviceIDs, "fpga-0")
+
+	var trainer []byte
+	trainer = appendString(trainer, fieldContainerName, "trainer")
+	trainer = appendMessage(trainer, fieldContainerDevices, devices)
+	trainer = appendMessage(trainer, fieldContainerDevices, cpus)
+	var sidecar []byte
+	sidecar = appendString(sidecar, fieldContainerName, "sidecar")
+
+	var pod []byte
+	pod = appendString(pod, fieldPodName, "train-0")
+	pod = appendString(pod, fieldPodNamespace, "ml")
+	// Fields of other wire types, such as the CPU IDs of newer kubelets,
+	// are skipped.
+	pod = protowire.AppendTag(pod, 99, protowire.VarintType)
+	pod = protowire.AppendVarint(pod, 7)
+	pod = appendMessage(pod, fieldPodContainers, trainer)
+	pod = appendMessage(pod, fieldPodContainers, sidecar)
+	var idle []byte
+	idle = appendString(idle, fieldPodName, "idle")
+	idle = appendString(idle, fieldPodNamespace, "default")
+
+	var response []byte
+	response = appendMessage(response, fieldPodResources, pod)
+	response = appendMessage(response, fieldPodResources, idle)
+
+	for _, tc := range []struct {
+		name    string
+		message []byte
+		want    []Allocation
+		wantErr bool
+	}{
+		{
+			name:    "allocations",
+			message: response,
+			want: []Allocation{
+				{Namespace: "ml", Pod: "train-0", Container: "trainer", Resource: "nvidia.com/gpu", DeviceID: "GPU-a"},
+				{Namespace: "ml", Pod: "train-0", Container: "trainer", Resource: "nvidia.com/gpu", DeviceID: "GPU-b::1"},
+				{Namespace: "ml", Pod: "train-0", Container: "trainer", Resource: "example.com/fpga", DeviceID: "fpga-0"},
+			},
+		},
+		{name: "empty", message: nil},
+		{name: "truncated", message: response[:len(response)-3], wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeListResponse(tc.message)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("decodeListResponse() error = %v, want error %t", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("decodeListResponse() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Package unixgrpc makes unary gRPC calls to local daemons listening on a
+// unix socket, such as the kubelet and the container runtime.
+//
+// The exporter only needs a handful of calls, so it speaks the gRPC wire
+// protocol over HTTP/2 directly instead of pulling in the gRPC module and the
+// generated API packages.
+package unixgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxResponseSize bounds responses, like the default of gRPC clients.
+const maxResponseSize = 16 << 20
+
+// Client calls gRPC methods served on a unix socket.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client for the gRPC server listening on socket.
+func NewClient(socket string) *Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &Client{
+		http: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Protocols: &protocols,
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// Invoke calls method, e.g. "/v1.PodResourcesLister/List", with the encoded
+// request message and returns the encoded response message.
+func (c *Client) Invoke(ctx context.Context, method string, request []byte) ([]byte, error) {
+	// Frame the request as a single uncompressed gRPC message.
+	body := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(request)))
+	body = append(body, request...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost"+method, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", method, resp.Status)
+	}
+
+	message, err := readMessage(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	if err := grpcStatus(resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+	return message, nil
+}
+
+// readMessage reads a single length-prefixed gRPC message.
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			// Trailers-only response, the status tells what went wrong.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read message prefix: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxResponseSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	// Drain the body so the trailers are available.
+	_, _ = io.Copy(io.Discard, r)
+	return message, nil
+}
+
+// grpcStatus returns the error reported in the gRPC status of resp, which is
+// sent as a trailer or, for trailers-only responses, as a header.
+func grpcStatus(resp *http.Response) error {
+	code := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if code == "" {
+		code = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if code == "" || code == "0" {
+		return nil
+	}
+	return fmt.Errorf("grpc status %s: %s", code, message)
+}
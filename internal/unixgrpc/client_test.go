@@ -0,0 +1,161 @@
+package unixgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// frame returns message as a length-prefixed gRPC message.
+func frame(compressed byte, message []byte) []byte {
+	b := []byte{compressed, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(len(message)))
+	return append(b, message...)
+}
+
+func TestReadMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    []byte
+		want    []byte
+		wantErr string
+	}{
+		{name: "message", body: frame(0, []byte("hello")), want: []byte("hello")},
+		{name: "empty message", body: frame(0, nil), want: []byte{}},
+		{name: "trailers only", body: nil, want: nil},
+		{name: "truncated prefix", body: []byte{0, 0}, wantErr: "read message prefix"},
+		{name: "truncated message", body: frame(0, []byte("hello"))[:7], wantErr: "read message"},
+		{name: "compressed", body: frame(1, []byte("hello")), wantErr: "compressed messages are not supported"},
+		{name: "too large", body: []byte{0, 0xff, 0xff, 0xff, 0xff}, wantErr: "exceeds the limit"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := readMessage(bytes.NewReader(tc.body))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("readMessage() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readMessage() error = %v", err)
+			}
+			if !bytes.Equal(got, tc.want) || (got == nil) != (tc.want == nil) {
+				t.Errorf("readMessage() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestForEachField(t *testing.T) {
+	var message []byte
+	message = protowire.AppendTag(message, 1, protowire.BytesType)
+	message = protowire.AppendString(message, "a")
+	message = protowire.AppendTag(message, 2, protowire.VarintType)
+	message = protowire.AppendVarint(message, 300)
+	message = protowire.AppendTag(message, 3, protowire.Fixed64Type)
+	message = protowire.AppendFixed64(message, 1)
+	message = protowire.AppendTag(message, 1, protowire.BytesType)
+	message = protowire.AppendString(message, "b")
+
+	type field struct {
+		num   protowire.Number
+		value string
+	}
+	for _, tc := range []struct {
+		name    string
+		message []byte
+		want    []field
+		wantErr bool
+	}{
+		{name: "length-delimited fields only", message: message, want: []field{{1, "a"}, {1, "b"}}},
+		{name: "empty", message: nil},
+		{name: "truncated value", message: message[:len(message)-1], want: []field{{1, "a"}}, wantErr: true},
+		{name: "invalid tag", message: []byte{0xff}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []field
+			err := ForEachField(tc.message, func(num protowire.Number, value []byte) error {
+				got = append(got, field{num, string(value)})
+				return nil
+			})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ForEachField() error = %v, want error %t", err, tc.wantErr)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("ForEachField() visited %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("field %d = %v, want %v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "grpc.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{
+		Protocols: &protocols,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/grpc")
+			switch r.URL.Path {
+			case "/test.Service/Echo":
+				// The request is framed already, so it is echoed as is.
+				w.Header().Set("Trailer", "Grpc-Status")
+				_, _ = w.Write(request)
+				w.Header().Set("Grpc-Status", "0")
+			case "/test.Service/Fail":
+				// A trailers-only response.
+				w.Header().Set("Grpc-Status", "12")
+				w.Header().Set("Grpc-Message", "unimplemented")
+			default:
+				http.NotFound(w, r)
+			}
+		}),
+	}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	client := NewClient(socket)
+	for _, tc := range []struct {
+		method  string
+		want    string
+		wantErr string
+	}{
+		{method: "/test.Service/Echo", want: "ping"},
+		{method: "/test.Service/Fail", wantErr: "grpc status 12: unimplemented"},
+		{method: "/test.Service/Missing", wantErr: "404"},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			got, err := client.Invoke(context.Background(), tc.method, []byte("ping"))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Invoke() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Invoke() error = %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("Invoke() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
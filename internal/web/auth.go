@@ -0,0 +1,30 @@
+package web
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// BearerAuth wraps next so that requests must carry the token stored in
+// token as an "Authorization: Bearer" header. The token file is re-read when
+// it changes.
+func BearerAuth(next http.Handler, token *SecretFile, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected, _, err := token.Load()
+		if err != nil {
+			logger.Warn("failed to reload bearer token", "err", err)
+		}
+		expected = bytes.TrimSpace(expected)
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || len(expected) == 0 || subtle.ConstantTimeCompare([]byte(given), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
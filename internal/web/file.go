@@ -0,0 +1,60 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// SecretFile is a credential stored on disk. The file is re-read whenever its
+// modification time or size changes, so rotated secrets are picked up without
+// restarting the exporter.
+type SecretFile struct {
+	path string
+
+	mtx     sync.Mutex
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// NewSecretFile reads the secret at path. It fails if the file can't be read,
+// so a misconfigured path is reported at startup rather than on first use.
+func NewSecretFile(path string) (*SecretFile, error) {
+	f := &SecretFile{path: path}
+	if _, _, err := f.Load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the file the secret is read from.
+func (f *SecretFile) Path() string {
+	return f.path
+}
+
+// Load returns the current content of the secret and whether it changed
+// since the previous call. If the file can't be re-read, the last good
+// content is returned along with the error.
+func (f *SecretFile) Load() ([]byte, bool, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return f.data, false, fmt.Errorf("stat secret file %q: %w", f.path, err)
+	}
+	if f.data != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.data, false, nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return f.data, false, fmt.Errorf("read secret file %q: %w", f.path, err)
+	}
+	f.data = data
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return f.data, true, nil
+}
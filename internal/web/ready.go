@@ -0,0 +1,18 @@
+package web
+
+import (
+	"net/http"
+)
+
+// ReadyHandler responds with 200 while check returns nil and with 503 and
+// the returned reason otherwise.
+func ReadyHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, "Not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Ready.\n"))
+	})
+}
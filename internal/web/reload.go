@@ -0,0 +1,23 @@
+package web
+
+import (
+	"net/http"
+)
+
+// ReloadHandler calls reload on POST requests, responding with 200 if it
+// returns nil and with 500 and the returned error otherwise.
+func ReloadHandler(reload func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Only POST requests allowed.", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, "Failed to reload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Reloaded.\n"))
+	})
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// KeyPair serves a TLS certificate from a certificate and key file, reloading
+// it whenever either file is rotated.
+type KeyPair struct {
+	cert   *SecretFile
+	key    *SecretFile
+	logger *slog.Logger
+
+	mtx     sync.Mutex
+	current *tls.Certificate
+}
+
+// NewKeyPair loads the certificate and key from the given files.
+func NewKeyPair(certFile, keyFile string, logger *slog.Logger) (*KeyPair, error) {
+	cert, err := NewSecretFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewSecretFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	kp := &KeyPair{cert: cert, key: key, logger: logger}
+	certPEM, _, _ := cert.Load()
+	keyPEM, _, _ := key.Load()
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS key pair: %w", err)
+	}
+	kp.current = &pair
+	return kp, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. When the files have
+// changed but don't form a valid pair yet (e.g. the certificate was replaced
+// before the key), the previous certificate keeps being served.
+func (kp *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+
+	certPEM, certChanged, err := kp.cert.Load()
+	if err != nil {
+		kp.logger.Warn("failed to reload TLS certificate", "err", err)
+	}
+	keyPEM, keyChanged, err := kp.key.Load()
+	if err != nil {
+		kp.logger.Warn("failed to reload TLS key", "err", err)
+	}
+	if !certChanged && !keyChanged {
+		return kp.current, nil
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		kp.logger.Warn("rotated TLS key pair is invalid, serving previous certificate", "err", err)
+		return kp.current, nil
+	}
+	kp.logger.Info("reloaded TLS key pair", "cert_file", kp.cert.Path(), "key_file", kp.key.Path())
+	kp.current = &pair
+	return kp.current, nil
+}
+
+// TLSConfig returns a server TLS configuration backed by the key pair.
+func (kp *KeyPair) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: kp.GetCertificate,
+	}
+}